@@ -0,0 +1,38 @@
+// Package dataservices provides the shared building blocks used by every
+// bucket-backed service, plus the sentinel errors their lookups return.
+package dataservices
+
+import (
+	"github.com/pkg/errors"
+	portainer "github.com/portainer/portainer/api"
+)
+
+// ErrObjectNotFound is returned by a BaseDataService lookup when no object
+// exists for the given key.
+var ErrObjectNotFound = errors.New("Object not found inside the database")
+
+// BaseDataService provides the operations common to every bucket-backed
+// service: a thin, generic wrapper around a single bucket of the underlying
+// Connection storing values of type T keyed by ID.
+type BaseDataService[T any, ID any] struct {
+	Bucket     string
+	Connection portainer.Connection
+}
+
+// ReadAll returns every object stored in the bucket.
+func (service BaseDataService[T, ID]) ReadAll() ([]T, error) {
+	var all []T
+
+	err := service.Connection.GetAll(service.Bucket, new(T), func(o interface{}) (interface{}, error) {
+		if obj, ok := o.(*T); ok {
+			all = append(all, *obj)
+		}
+
+		return new(T), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return all, nil
+}
@@ -0,0 +1,30 @@
+// Package datastore declares DataStore, the aggregate interface the edge
+// stacks handler uses to reach every bucket-backed service it depends on.
+package datastore
+
+import (
+	portainer "github.com/portainer/portainer/api"
+	"github.com/portainer/portainer/api/dataservices"
+	"github.com/portainer/portainer/api/dataservices/edgestackrollout"
+	"github.com/portainer/portainer/api/dataservices/edgestacktemplates"
+)
+
+// DataStore lists the accessors used by the edge stack config template and
+// override features. It composes with the broader datastore interface
+// maintained elsewhere in the codebase - only the methods this package's
+// callers actually need are reproduced here.
+type DataStore interface {
+	EdgeStack() portainer.EdgeStackService
+	Endpoint() portainer.EndpointService
+	EndpointRelation() portainer.EndpointRelationService
+
+	EdgeStackTemplates() *edgestacktemplates.Service
+	EdgeStackTemplateOverrides() *edgestacktemplates.OverridesService
+	EdgeStackRollouts() *edgestackrollout.Service
+
+	// RunInTransaction calls fn with a DataStoreTx backed by a single
+	// underlying database transaction: if fn returns an error, every write
+	// made through tx is rolled back, so a partial failure never leaves the
+	// datastore with only some of the intended changes applied.
+	RunInTransaction(fn func(tx dataservices.DataStoreTx) error) error
+}
@@ -0,0 +1,66 @@
+package edgestackrollout
+
+import (
+	portainer "github.com/portainer/portainer/api"
+	"github.com/portainer/portainer/api/dataservices"
+	"github.com/portainer/portainer/api/internal/edgestackrollout"
+)
+
+// BucketName represents the name of the bucket where this service stores data.
+const BucketName = "edgestack_rollouts"
+
+// Service represents a service for managing EdgeStack rollouts. A Rollout is
+// keyed by the EdgeStackID it belongs to, since an EdgeStack has at most one
+// rollout in flight.
+type Service struct {
+	dataservices.BaseDataService[edgestackrollout.Rollout, portainer.EdgeStackID]
+}
+
+// NewService creates a new instance of Service.
+func NewService(connection portainer.Connection) (*Service, error) {
+	return &Service{
+		BaseDataService: dataservices.BaseDataService[edgestackrollout.Rollout, portainer.EdgeStackID]{
+			Bucket:     BucketName,
+			Connection: connection,
+		},
+	}, nil
+}
+
+// Rollout returns the in-flight rollout for an EdgeStack, if any.
+func (service *Service) Rollout(edgeStackID portainer.EdgeStackID) (*edgestackrollout.Rollout, error) {
+	var rollout edgestackrollout.Rollout
+
+	err := service.Connection.GetObject(BucketName, service.Connection.ConvertToKey(int(edgeStackID)), &rollout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rollout, nil
+}
+
+// UpdateRollout persists the rollout for an EdgeStack, creating it if it
+// does not already exist.
+func (service *Service) UpdateRollout(edgeStackID portainer.EdgeStackID, rollout *edgestackrollout.Rollout) error {
+	return service.Connection.UpdateObject(BucketName, service.Connection.ConvertToKey(int(edgeStackID)), rollout)
+}
+
+// DeleteRollout removes the rollout associated to an EdgeStack.
+func (service *Service) DeleteRollout(edgeStackID portainer.EdgeStackID) error {
+	return service.Connection.DeleteObject(BucketName, service.Connection.ConvertToKey(int(edgeStackID)))
+}
+
+// ActiveEdgeStackIDs returns the identifier of every EdgeStack that has a
+// rollout persisted, so the rollout controller knows which ones to advance.
+func (service *Service) ActiveEdgeStackIDs() ([]portainer.EdgeStackID, error) {
+	all, err := service.BaseDataService.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]portainer.EdgeStackID, 0, len(all))
+	for _, rollout := range all {
+		ids = append(ids, rollout.EdgeStackID)
+	}
+
+	return ids, nil
+}
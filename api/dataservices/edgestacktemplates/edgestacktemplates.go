@@ -0,0 +1,62 @@
+package edgestacktemplates
+
+import (
+	portainer "github.com/portainer/portainer/api"
+	"github.com/portainer/portainer/api/dataservices"
+)
+
+// BucketName represents the name of the bucket where this service stores data.
+const BucketName = "edgestack_templates"
+
+// Template is the manifest template and default values for an EdgeStack.
+// The effective manifest for a given environment is produced by merging
+// DefaultValues with any applicable OverrideSet (see the edgestacktemplates
+// internal package) and executing Content as a Go text/template, exposing
+// the merged values under `.Values` - a subset of Helm's `.Values.foo`
+// convention.
+//
+// A Template is keyed by the EdgeStackID it belongs to, since an EdgeStack
+// has at most one config template.
+type Template struct {
+	EdgeStackID   portainer.EdgeStackID  `json:"EdgeStackID"`
+	Content       string                 `json:"Content"`
+	DefaultValues map[string]interface{} `json:"DefaultValues"`
+}
+
+// Service represents a service for managing edge stack config templates.
+type Service struct {
+	dataservices.BaseDataService[Template, portainer.EdgeStackID]
+}
+
+// NewService creates a new instance of Service.
+func NewService(connection portainer.Connection) (*Service, error) {
+	return &Service{
+		BaseDataService: dataservices.BaseDataService[Template, portainer.EdgeStackID]{
+			Bucket:     BucketName,
+			Connection: connection,
+		},
+	}, nil
+}
+
+// Template returns the config template associated to an EdgeStack.
+func (service *Service) Template(edgeStackID portainer.EdgeStackID) (*Template, error) {
+	var template Template
+
+	err := service.Connection.GetObject(BucketName, service.Connection.ConvertToKey(int(edgeStackID)), &template)
+	if err != nil {
+		return nil, err
+	}
+
+	return &template, nil
+}
+
+// UpdateTemplate persists the config template for an EdgeStack, creating it
+// if it does not already exist.
+func (service *Service) UpdateTemplate(edgeStackID portainer.EdgeStackID, template *Template) error {
+	return service.Connection.UpdateObject(BucketName, service.Connection.ConvertToKey(int(edgeStackID)), template)
+}
+
+// DeleteTemplate removes the config template associated to an EdgeStack.
+func (service *Service) DeleteTemplate(edgeStackID portainer.EdgeStackID) error {
+	return service.Connection.DeleteObject(BucketName, service.Connection.ConvertToKey(int(edgeStackID)))
+}
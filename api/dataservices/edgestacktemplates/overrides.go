@@ -0,0 +1,100 @@
+package edgestacktemplates
+
+import (
+	portainer "github.com/portainer/portainer/api"
+	"github.com/portainer/portainer/api/dataservices"
+)
+
+// OverridesBucketName represents the name of the bucket where override sets
+// are stored.
+const OverridesBucketName = "edgestack_template_overrides"
+
+// OverrideSetID represents the identifier of a Template OverrideSet.
+type OverrideSetID int
+
+// OverrideScope identifies what an OverrideSet applies to.
+type OverrideScope string
+
+const (
+	// OverrideScopeEndpoint scopes an OverrideSet to a single environment.
+	OverrideScopeEndpoint OverrideScope = "endpoint"
+	// OverrideScopeEdgeGroup scopes an OverrideSet to every environment of an Edge group.
+	OverrideScopeEdgeGroup OverrideScope = "edgegroup"
+)
+
+// OverrideSet is a named set of template value overrides scoped to either a
+// single environment (EndpointID) or an Edge group (EdgeGroupID). When
+// rendering a Template for a given environment, EndpointID-scoped overrides
+// take precedence over EdgeGroupID-scoped ones, which in turn take
+// precedence over the Template's DefaultValues.
+type OverrideSet struct {
+	ID          OverrideSetID          `json:"Id"`
+	EdgeStackID portainer.EdgeStackID  `json:"EdgeStackID"`
+	Scope       OverrideScope          `json:"Scope"`
+	EndpointID  portainer.EndpointID   `json:"EndpointID,omitempty"`
+	EdgeGroupID portainer.EdgeGroupID  `json:"EdgeGroupID,omitempty"`
+	Values      map[string]interface{} `json:"Values"`
+}
+
+// OverridesService represents a service for managing Template OverrideSets.
+type OverridesService struct {
+	dataservices.BaseDataService[OverrideSet, OverrideSetID]
+}
+
+// NewOverridesService creates a new instance of OverridesService.
+func NewOverridesService(connection portainer.Connection) (*OverridesService, error) {
+	return &OverridesService{
+		BaseDataService: dataservices.BaseDataService[OverrideSet, OverrideSetID]{
+			Bucket:     OverridesBucketName,
+			Connection: connection,
+		},
+	}, nil
+}
+
+// OverrideSet returns a single OverrideSet by identifier.
+func (service *OverridesService) OverrideSet(ID OverrideSetID) (*OverrideSet, error) {
+	var set OverrideSet
+
+	err := service.Connection.GetObject(OverridesBucketName, service.Connection.ConvertToKey(int(ID)), &set)
+	if err != nil {
+		return nil, err
+	}
+
+	return &set, nil
+}
+
+// OverrideSetsByEdgeStackID returns every OverrideSet belonging to the
+// specified EdgeStack.
+func (service *OverridesService) OverrideSetsByEdgeStackID(edgeStackID portainer.EdgeStackID) ([]OverrideSet, error) {
+	all, err := service.BaseDataService.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]OverrideSet, 0, len(all))
+	for _, set := range all {
+		if set.EdgeStackID == edgeStackID {
+			result = append(result, set)
+		}
+	}
+
+	return result, nil
+}
+
+// CreateOverrideSet persists a new OverrideSet, assigning it an identifier.
+func (service *OverridesService) CreateOverrideSet(set *OverrideSet) error {
+	return service.Connection.CreateObject(OverridesBucketName, func(id int) (int, interface{}) {
+		set.ID = OverrideSetID(id)
+		return id, set
+	})
+}
+
+// UpdateOverrideSet persists changes to an existing OverrideSet.
+func (service *OverridesService) UpdateOverrideSet(ID OverrideSetID, set *OverrideSet) error {
+	return service.Connection.UpdateObject(OverridesBucketName, service.Connection.ConvertToKey(int(ID)), set)
+}
+
+// DeleteOverrideSet removes an OverrideSet from the database.
+func (service *OverridesService) DeleteOverrideSet(ID OverrideSetID) error {
+	return service.Connection.DeleteObject(OverridesBucketName, service.Connection.ConvertToKey(int(ID)))
+}
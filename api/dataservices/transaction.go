@@ -0,0 +1,11 @@
+package dataservices
+
+import portainer "github.com/portainer/portainer/api"
+
+// DataStoreTx is the transactional view of the datastore exposed to the
+// function passed to DataStore.RunInTransaction. Every call made through it
+// applies inside the same underlying database transaction, so either all of
+// them are persisted or, if the function returns an error, none are.
+type DataStoreTx interface {
+	EndpointRelation() portainer.EndpointRelationService
+}
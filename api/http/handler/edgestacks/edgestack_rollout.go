@@ -0,0 +1,248 @@
+package edgestacks
+
+import (
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	httperror "github.com/portainer/libhttp/error"
+	"github.com/portainer/libhttp/request"
+	"github.com/portainer/libhttp/response"
+	portainer "github.com/portainer/portainer/api"
+	"github.com/portainer/portainer/api/internal/edgestackrollout"
+)
+
+// retainVersionedFile stores a copy of fileContent under
+// stackFolder/versions/<version>/fileName, so that a rollout can later be
+// rolled back to this version even after stackFolder/fileName has since been
+// overwritten by a newer version. When j is non-nil, the new version folder
+// is recorded so it can be removed again if a later step of the update
+// fails.
+func (handler *Handler) retainVersionedFile(stackFolder, fileName string, version int, fileContent []byte, j *updateJournal) error {
+	versionFolder := filepath.Join(stackFolder, "versions", strconv.Itoa(version))
+
+	_, err := handler.FileService.StoreEdgeStackFileFromBytes(versionFolder, fileName, fileContent)
+	if err != nil {
+		return err
+	}
+
+	if j != nil {
+		j.record(func() { handler.removeJournaledDirectory(versionFolder) })
+	}
+
+	return nil
+}
+
+// startRollout persists rollout, replacing any previous rollout for the
+// stack, so the rollout controller picks it up and promotes its remaining
+// batches as they become healthy.
+func (handler *Handler) startRollout(stack *portainer.EdgeStack, rollout *edgestackrollout.Rollout) error {
+	return handler.DataStore.EdgeStackRollouts().UpdateRollout(stack.ID, rollout)
+}
+
+// @id EdgeStackRolloutInspect
+// @summary Retrieve the in-flight rollout of an EdgeStack
+// @description **Access policy**: administrator
+// @tags edge_stacks
+// @security ApiKeyAuth
+// @security jwt
+// @produce json
+// @param id path string true "EdgeStack Id"
+// @success 200 {object} edgestackrollout.Rollout
+// @failure 500
+// @failure 400
+// @failure 404 "The stack has no rollout in progress"
+// @router /edge_stacks/{id}/rollout [get]
+func (handler *Handler) edgeStackRolloutInspect(w http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	stackID, err := request.RetrieveNumericRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid stack identifier route variable", err)
+	}
+
+	rollout, err := handler.DataStore.EdgeStackRollouts().Rollout(portainer.EdgeStackID(stackID))
+	if err != nil {
+		return handler.handlerDBErr(err, "Unable to find a rollout for the specified stack inside the database")
+	}
+
+	return response.JSON(w, rollout)
+}
+
+func (handler *Handler) withRollout(w http.ResponseWriter, r *http.Request, fn func(rollout *edgestackrollout.Rollout)) *httperror.HandlerError {
+	stackID, err := request.RetrieveNumericRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid stack identifier route variable", err)
+	}
+
+	rollout, err := handler.DataStore.EdgeStackRollouts().Rollout(portainer.EdgeStackID(stackID))
+	if err != nil {
+		return handler.handlerDBErr(err, "Unable to find a rollout for the specified stack inside the database")
+	}
+
+	fn(rollout)
+
+	err = handler.DataStore.EdgeStackRollouts().UpdateRollout(rollout.EdgeStackID, rollout)
+	if err != nil {
+		return httperror.InternalServerError("Unable to persist the rollout inside the database", err)
+	}
+
+	return response.JSON(w, rollout)
+}
+
+// withFinishedRollout applies fn to the in-flight rollout of the stack
+// identified by the "id" route variable, then removes the rollout from the
+// database rather than persisting it, since fn is expected to move it to a
+// terminal state (aborted). This keeps the rollout controller from ticking
+// a finished rollout forever.
+func (handler *Handler) withFinishedRollout(w http.ResponseWriter, r *http.Request, fn func(rollout *edgestackrollout.Rollout)) *httperror.HandlerError {
+	stackID, err := request.RetrieveNumericRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid stack identifier route variable", err)
+	}
+
+	rollout, err := handler.DataStore.EdgeStackRollouts().Rollout(portainer.EdgeStackID(stackID))
+	if err != nil {
+		return handler.handlerDBErr(err, "Unable to find a rollout for the specified stack inside the database")
+	}
+
+	fn(rollout)
+
+	err = handler.DataStore.EdgeStackRollouts().DeleteRollout(rollout.EdgeStackID)
+	if err != nil {
+		return httperror.InternalServerError("Unable to remove the finished rollout from the database", err)
+	}
+
+	return response.JSON(w, rollout)
+}
+
+// @id EdgeStackRolloutPause
+// @summary Pause the in-flight rollout of an EdgeStack
+// @description **Access policy**: administrator
+// @tags edge_stacks
+// @security ApiKeyAuth
+// @security jwt
+// @produce json
+// @param id path string true "EdgeStack Id"
+// @success 200 {object} edgestackrollout.Rollout
+// @failure 500
+// @failure 400
+// @failure 404
+// @router /edge_stacks/{id}/rollout/pause [post]
+func (handler *Handler) edgeStackRolloutPause(w http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	return handler.withRollout(w, r, (*edgestackrollout.Rollout).Pause)
+}
+
+// @id EdgeStackRolloutResume
+// @summary Resume a paused rollout of an EdgeStack
+// @description **Access policy**: administrator
+// @tags edge_stacks
+// @security ApiKeyAuth
+// @security jwt
+// @produce json
+// @param id path string true "EdgeStack Id"
+// @success 200 {object} edgestackrollout.Rollout
+// @failure 500
+// @failure 400
+// @failure 404
+// @router /edge_stacks/{id}/rollout/resume [post]
+func (handler *Handler) edgeStackRolloutResume(w http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	return handler.withRollout(w, r, (*edgestackrollout.Rollout).Resume)
+}
+
+// @id EdgeStackRolloutAbort
+// @summary Abort the in-flight rollout of an EdgeStack, leaving every environment at its current version
+// @description **Access policy**: administrator
+// @tags edge_stacks
+// @security ApiKeyAuth
+// @security jwt
+// @produce json
+// @param id path string true "EdgeStack Id"
+// @success 200 {object} edgestackrollout.Rollout
+// @failure 500
+// @failure 400
+// @failure 404
+// @router /edge_stacks/{id}/rollout/abort [post]
+func (handler *Handler) edgeStackRolloutAbort(w http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	return handler.withFinishedRollout(w, r, (*edgestackrollout.Rollout).Abort)
+}
+
+// @id EdgeStackRolloutRollback
+// @summary Abort the in-flight rollout of an EdgeStack and revert every environment to the previous version
+// @description **Access policy**: administrator
+// @tags edge_stacks
+// @security ApiKeyAuth
+// @security jwt
+// @produce json
+// @param id path string true "EdgeStack Id"
+// @success 200 {object} edgestackrollout.Rollout
+// @failure 500
+// @failure 400
+// @failure 404
+// @router /edge_stacks/{id}/rollout/rollback [post]
+func (handler *Handler) edgeStackRolloutRollback(w http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	stackID, err := request.RetrieveNumericRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid stack identifier route variable", err)
+	}
+
+	rollout, err := handler.DataStore.EdgeStackRollouts().Rollout(portainer.EdgeStackID(stackID))
+	if err != nil {
+		return handler.handlerDBErr(err, "Unable to find a rollout for the specified stack inside the database")
+	}
+
+	stack, err := handler.DataStore.EdgeStack().EdgeStack(rollout.EdgeStackID)
+	if err != nil {
+		return handler.handlerDBErr(err, "Unable to find a stack with the specified identifier inside the database")
+	}
+
+	err = handler.restoreRolloutVersion(stack, rollout)
+	if err != nil {
+		return httperror.InternalServerError("Unable to restore the previous version of the edge stack", err)
+	}
+
+	rollout.Rollback()
+
+	err = handler.DataStore.EdgeStackRollouts().DeleteRollout(rollout.EdgeStackID)
+	if err != nil {
+		return httperror.InternalServerError("Unable to remove the finished rollout from the database", err)
+	}
+
+	return response.JSON(w, rollout)
+}
+
+// restoreRolloutVersion reverts stack back to rollout.FromVersion: the file
+// retained under stackFolder/versions/<FromVersion> by retainVersionedFile is
+// written back over the live file, as well as over the folder of every
+// environment the rollout covers, whether or not it had been promoted yet,
+// and the EdgeStack's own Version is reverted to match.
+func (handler *Handler) restoreRolloutVersion(stack *portainer.EdgeStack, rollout *edgestackrollout.Rollout) error {
+	stackFolder := strconv.Itoa(int(stack.ID))
+
+	fileName := stack.EntryPoint
+	if stack.DeploymentType == portainer.EdgeStackDeploymentKubernetes {
+		fileName = stack.ManifestPath
+	}
+
+	versionFolder := filepath.Join(stackFolder, "versions", strconv.Itoa(rollout.FromVersion))
+
+	content, err := handler.FileService.GetFileContent(versionFolder, fileName)
+	if err != nil {
+		return err
+	}
+
+	if _, err := handler.FileService.StoreEdgeStackFileFromBytes(stackFolder, fileName, content); err != nil {
+		return err
+	}
+
+	for endpointID := range rollout.TargetVersions {
+		endpointFolder := filepath.Join(stackFolder, strconv.Itoa(int(endpointID)))
+
+		if _, err := handler.FileService.StoreEdgeStackFileFromBytes(endpointFolder, fileName, content); err != nil {
+			return err
+		}
+	}
+
+	return handler.DataStore.EdgeStack().UpdateEdgeStackFunc(stack.ID, func(edgeStack *portainer.EdgeStack) {
+		edgeStack.Version = rollout.FromVersion
+		edgeStack.Status = make(map[portainer.EndpointID]portainer.EdgeStackStatus)
+	})
+}
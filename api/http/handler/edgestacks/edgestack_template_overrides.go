@@ -0,0 +1,212 @@
+package edgestacks
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+	httperror "github.com/portainer/libhttp/error"
+	"github.com/portainer/libhttp/request"
+	"github.com/portainer/libhttp/response"
+	portainer "github.com/portainer/portainer/api"
+	"github.com/portainer/portainer/api/dataservices/edgestacktemplates"
+)
+
+type edgeStackTemplateOverridePayload struct {
+	Scope       edgestacktemplates.OverrideScope
+	EndpointID  portainer.EndpointID
+	EdgeGroupID portainer.EdgeGroupID
+	Values      map[string]interface{}
+}
+
+func (payload *edgeStackTemplateOverridePayload) Validate(r *http.Request) error {
+	switch payload.Scope {
+	case edgestacktemplates.OverrideScopeEndpoint:
+		if payload.EndpointID == 0 {
+			return errors.New("EndpointID is mandatory for an environment-scoped override")
+		}
+	case edgestacktemplates.OverrideScopeEdgeGroup:
+		if payload.EdgeGroupID == 0 {
+			return errors.New("EdgeGroupID is mandatory for an Edge group-scoped override")
+		}
+	default:
+		return errors.New("Invalid override scope, must be one of: endpoint, edgegroup")
+	}
+
+	if len(payload.Values) == 0 {
+		return errors.New("Invalid or missing override values")
+	}
+
+	return nil
+}
+
+// @id EdgeStackTemplateOverrideList
+// @summary List the config template override sets of an EdgeStack
+// @description **Access policy**: administrator
+// @tags edge_stacks
+// @security ApiKeyAuth
+// @security jwt
+// @produce json
+// @param id path string true "EdgeStack Id"
+// @success 200 {array} edgestacktemplates.OverrideSet
+// @failure 500
+// @failure 400
+// @router /edge_stacks/{id}/template/overrides [get]
+func (handler *Handler) edgeStackTemplateOverrideList(w http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	stackID, err := request.RetrieveNumericRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid stack identifier route variable", err)
+	}
+
+	if _, err := handler.DataStore.EdgeStack().EdgeStack(portainer.EdgeStackID(stackID)); err != nil {
+		return handler.handlerDBErr(err, "Unable to find a stack with the specified identifier inside the database")
+	}
+
+	overrides, err := handler.DataStore.EdgeStackTemplateOverrides().OverrideSetsByEdgeStackID(portainer.EdgeStackID(stackID))
+	if err != nil {
+		return httperror.InternalServerError("Unable to retrieve the config template overrides from the database", err)
+	}
+
+	return response.JSON(w, overrides)
+}
+
+// @id EdgeStackTemplateOverrideCreate
+// @summary Create a config template override set for an EdgeStack
+// @description **Access policy**: administrator
+// @tags edge_stacks
+// @security ApiKeyAuth
+// @security jwt
+// @accept json
+// @produce json
+// @param id path string true "EdgeStack Id"
+// @param body body edgeStackTemplateOverridePayload true "Override set data"
+// @success 200 {object} edgestacktemplates.OverrideSet
+// @failure 500
+// @failure 400
+// @router /edge_stacks/{id}/template/overrides [post]
+func (handler *Handler) edgeStackTemplateOverrideCreate(w http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	stackID, err := request.RetrieveNumericRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid stack identifier route variable", err)
+	}
+
+	if _, err := handler.DataStore.EdgeStack().EdgeStack(portainer.EdgeStackID(stackID)); err != nil {
+		return handler.handlerDBErr(err, "Unable to find a stack with the specified identifier inside the database")
+	}
+
+	var payload edgeStackTemplateOverridePayload
+	err = request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	override := &edgestacktemplates.OverrideSet{
+		EdgeStackID: portainer.EdgeStackID(stackID),
+		Scope:       payload.Scope,
+		EndpointID:  payload.EndpointID,
+		EdgeGroupID: payload.EdgeGroupID,
+		Values:      payload.Values,
+	}
+
+	err = handler.DataStore.EdgeStackTemplateOverrides().CreateOverrideSet(override)
+	if err != nil {
+		return httperror.InternalServerError("Unable to persist the config template override inside the database", err)
+	}
+
+	return response.JSON(w, override)
+}
+
+// @id EdgeStackTemplateOverrideUpdate
+// @summary Update a config template override set
+// @description **Access policy**: administrator
+// @tags edge_stacks
+// @security ApiKeyAuth
+// @security jwt
+// @accept json
+// @produce json
+// @param id path string true "EdgeStack Id"
+// @param overrideId path string true "Override Id"
+// @param body body edgeStackTemplateOverridePayload true "Override set data"
+// @success 200 {object} edgestacktemplates.OverrideSet
+// @failure 500
+// @failure 400
+// @failure 404
+// @router /edge_stacks/{id}/template/overrides/{overrideId} [put]
+func (handler *Handler) edgeStackTemplateOverrideUpdate(w http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	stackID, err := request.RetrieveNumericRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid stack identifier route variable", err)
+	}
+
+	overrideID, err := request.RetrieveNumericRouteVariableValue(r, "overrideId")
+	if err != nil {
+		return httperror.BadRequest("Invalid override identifier route variable", err)
+	}
+
+	existing, err := handler.DataStore.EdgeStackTemplateOverrides().OverrideSet(edgestacktemplates.OverrideSetID(overrideID))
+	if err != nil {
+		return handler.handlerDBErr(err, "Unable to find the config template override inside the database")
+	}
+
+	if existing.EdgeStackID != portainer.EdgeStackID(stackID) {
+		return httperror.BadRequest("The override set does not belong to the specified stack", nil)
+	}
+
+	var payload edgeStackTemplateOverridePayload
+	err = request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	existing.Scope = payload.Scope
+	existing.EndpointID = payload.EndpointID
+	existing.EdgeGroupID = payload.EdgeGroupID
+	existing.Values = payload.Values
+
+	err = handler.DataStore.EdgeStackTemplateOverrides().UpdateOverrideSet(existing.ID, existing)
+	if err != nil {
+		return httperror.InternalServerError("Unable to persist the config template override inside the database", err)
+	}
+
+	return response.JSON(w, existing)
+}
+
+// @id EdgeStackTemplateOverrideDelete
+// @summary Remove a config template override set
+// @description **Access policy**: administrator
+// @tags edge_stacks
+// @security ApiKeyAuth
+// @security jwt
+// @param id path string true "EdgeStack Id"
+// @param overrideId path string true "Override Id"
+// @success 204
+// @failure 500
+// @failure 400
+// @failure 404
+// @router /edge_stacks/{id}/template/overrides/{overrideId} [delete]
+func (handler *Handler) edgeStackTemplateOverrideDelete(w http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	stackID, err := request.RetrieveNumericRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid stack identifier route variable", err)
+	}
+
+	overrideID, err := request.RetrieveNumericRouteVariableValue(r, "overrideId")
+	if err != nil {
+		return httperror.BadRequest("Invalid override identifier route variable", err)
+	}
+
+	existing, err := handler.DataStore.EdgeStackTemplateOverrides().OverrideSet(edgestacktemplates.OverrideSetID(overrideID))
+	if err != nil {
+		return handler.handlerDBErr(err, "Unable to find the config template override inside the database")
+	}
+
+	if existing.EdgeStackID != portainer.EdgeStackID(stackID) {
+		return httperror.BadRequest("The override set does not belong to the specified stack", nil)
+	}
+
+	err = handler.DataStore.EdgeStackTemplateOverrides().DeleteOverrideSet(edgestacktemplates.OverrideSetID(overrideID))
+	if err != nil {
+		return handler.handlerDBErr(err, "Unable to remove the config template override from the database")
+	}
+
+	return response.Empty(w)
+}
@@ -0,0 +1,66 @@
+package edgestacks
+
+import (
+	"net/http"
+
+	httperror "github.com/portainer/libhttp/error"
+	"github.com/portainer/libhttp/request"
+	"github.com/portainer/libhttp/response"
+	portainer "github.com/portainer/portainer/api"
+	"github.com/portainer/portainer/api/internal/edge"
+	"github.com/portainer/portainer/api/internal/edgestacktemplates"
+)
+
+type edgeStackTemplatePreviewResponse struct {
+	Manifest string `json:"Manifest"`
+}
+
+// @id EdgeStackTemplatePreview
+// @summary Render the effective manifest of an EdgeStack's config template for a given environment, without persisting it
+// @description **Access policy**: administrator
+// @tags edge_stacks
+// @security ApiKeyAuth
+// @security jwt
+// @produce json
+// @param id path string true "EdgeStack Id"
+// @param endpointId query int true "Environment (Endpoint) Id"
+// @success 200 {object} edgeStackTemplatePreviewResponse
+// @failure 500
+// @failure 400
+// @failure 404 "The stack has no config template"
+// @router /edge_stacks/{id}/template/preview [get]
+func (handler *Handler) edgeStackTemplatePreview(w http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	stackID, err := request.RetrieveNumericRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid stack identifier route variable", err)
+	}
+
+	endpointID, err := request.RetrieveNumericQueryParameter(r, "endpointId", false)
+	if err != nil {
+		return httperror.BadRequest("Invalid endpointId query parameter", err)
+	}
+
+	template, err := handler.DataStore.EdgeStackTemplates().Template(portainer.EdgeStackID(stackID))
+	if err != nil {
+		return handler.handlerDBErr(err, "Unable to find a config template for the specified stack inside the database")
+	}
+
+	overrides, err := handler.DataStore.EdgeStackTemplateOverrides().OverrideSetsByEdgeStackID(portainer.EdgeStackID(stackID))
+	if err != nil {
+		return httperror.InternalServerError("Unable to retrieve the config template overrides from the database", err)
+	}
+
+	relationConfig, err := edge.FetchEndpointRelationsConfig(handler.DataStore)
+	if err != nil {
+		return httperror.InternalServerError("Unable to retrieve environments relations config from database", err)
+	}
+
+	edgeGroupIDs := edgeGroupsForEndpoint(portainer.EndpointID(endpointID), relationConfig.EdgeGroups)
+
+	rendered, err := edgestacktemplates.Render(template, overrides, portainer.EndpointID(endpointID), edgeGroupIDs)
+	if err != nil {
+		return httperror.InternalServerError("Unable to render the config template", err)
+	}
+
+	return response.JSON(w, edgeStackTemplatePreviewResponse{Manifest: string(rendered)})
+}
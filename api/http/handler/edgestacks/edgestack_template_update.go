@@ -0,0 +1,97 @@
+package edgestacks
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+	httperror "github.com/portainer/libhttp/error"
+	"github.com/portainer/libhttp/request"
+	"github.com/portainer/libhttp/response"
+	portainer "github.com/portainer/portainer/api"
+	"github.com/portainer/portainer/api/dataservices/edgestacktemplates"
+)
+
+type updateEdgeStackTemplatePayload struct {
+	Content       string
+	DefaultValues map[string]interface{}
+}
+
+func (payload *updateEdgeStackTemplatePayload) Validate(r *http.Request) error {
+	if payload.Content == "" {
+		return errors.New("Invalid template content")
+	}
+	return nil
+}
+
+// @id EdgeStackTemplateUpdate
+// @summary Create or replace the config template of an EdgeStack
+// @description **Access policy**: administrator
+// @tags edge_stacks
+// @security ApiKeyAuth
+// @security jwt
+// @accept json
+// @produce json
+// @param id path string true "EdgeStack Id"
+// @param body body updateEdgeStackTemplatePayload true "Config template data"
+// @success 200 {object} edgestacktemplates.Template
+// @failure 500
+// @failure 400
+// @failure 503 "Edge compute features are disabled"
+// @router /edge_stacks/{id}/template [put]
+func (handler *Handler) edgeStackTemplateUpdate(w http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	stackID, err := request.RetrieveNumericRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid stack identifier route variable", err)
+	}
+
+	stack, err := handler.DataStore.EdgeStack().EdgeStack(portainer.EdgeStackID(stackID))
+	if err != nil {
+		return handler.handlerDBErr(err, "Unable to find a stack with the specified identifier inside the database")
+	}
+
+	var payload updateEdgeStackTemplatePayload
+	err = request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	template := &edgestacktemplates.Template{
+		EdgeStackID:   stack.ID,
+		Content:       payload.Content,
+		DefaultValues: payload.DefaultValues,
+	}
+
+	err = handler.DataStore.EdgeStackTemplates().UpdateTemplate(stack.ID, template)
+	if err != nil {
+		return httperror.InternalServerError("Unable to persist the config template inside the database", err)
+	}
+
+	return response.JSON(w, template)
+}
+
+// @id EdgeStackTemplateInspect
+// @summary Retrieve the config template of an EdgeStack
+// @description **Access policy**: administrator
+// @tags edge_stacks
+// @security ApiKeyAuth
+// @security jwt
+// @produce json
+// @param id path string true "EdgeStack Id"
+// @success 200 {object} edgestacktemplates.Template
+// @failure 500
+// @failure 400
+// @failure 404 "The stack has no config template"
+// @router /edge_stacks/{id}/template [get]
+func (handler *Handler) edgeStackTemplateInspect(w http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	stackID, err := request.RetrieveNumericRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid stack identifier route variable", err)
+	}
+
+	template, err := handler.DataStore.EdgeStackTemplates().Template(portainer.EdgeStackID(stackID))
+	if err != nil {
+		return handler.handlerDBErr(err, "Unable to find a config template for the specified stack inside the database")
+	}
+
+	return response.JSON(w, template)
+}
@@ -9,8 +9,11 @@ import (
 	"github.com/portainer/libhttp/request"
 	"github.com/portainer/libhttp/response"
 	portainer "github.com/portainer/portainer/api"
+	"github.com/portainer/portainer/api/dataservices"
 	"github.com/portainer/portainer/api/filesystem"
 	"github.com/portainer/portainer/api/internal/edge"
+	"github.com/portainer/portainer/api/internal/edgestackrollout"
+	"github.com/portainer/portainer/api/internal/edgestacktemplates"
 	"github.com/portainer/portainer/api/internal/set"
 	"github.com/rs/zerolog/log"
 )
@@ -22,6 +25,11 @@ type updateEdgeStackPayload struct {
 	DeploymentType   portainer.EdgeStackDeploymentType
 	// Uses the manifest's namespaces instead of the default one
 	UseManifestNamespaces bool
+	// If true, the update is validated and the resulting diff is returned but
+	// nothing is persisted: files are only written to a scratch directory that
+	// is removed again, UpdateEdgeStackFunc is not called and EndpointRelation
+	// is not mutated. Can also be triggered via the `dryRun` query parameter.
+	DryRun bool
 }
 
 func (payload *updateEdgeStackPayload) Validate(r *http.Request) error {
@@ -44,12 +52,20 @@ func (payload *updateEdgeStackPayload) Validate(r *http.Request) error {
 // @produce json
 // @param id path string true "EdgeStack Id"
 // @param body body updateEdgeStackPayload true "EdgeStack data"
+// @param dryRun query bool false "If true, validate the update and return the resulting diff without persisting anything"
 // @success 200 {object} portainer.EdgeStack
 // @failure 500
 // @failure 400
 // @failure 503 "Edge compute features are disabled"
 // @router /edge_stacks/{id} [put]
-func (handler *Handler) edgeStackUpdate(w http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+func (handler *Handler) edgeStackUpdate(w http.ResponseWriter, r *http.Request) (herr *httperror.HandlerError) {
+	j := newUpdateJournal(handler)
+	defer func() {
+		if herr != nil {
+			j.rollback()
+		}
+	}()
+
 	stackID, err := request.RetrieveNumericRouteVariableValue(r, "id")
 	if err != nil {
 		return httperror.BadRequest("Invalid stack identifier route variable", err)
@@ -66,6 +82,10 @@ func (handler *Handler) edgeStackUpdate(w http.ResponseWriter, r *http.Request)
 		return httperror.BadRequest("Invalid request payload", err)
 	}
 
+	if dryRun, _ := request.RetrieveBooleanQueryParameter(r, "dryRun", true); dryRun {
+		payload.DryRun = true
+	}
+
 	relationConfig, err := edge.FetchEndpointRelationsConfig(handler.DataStore)
 	if err != nil {
 		return httperror.InternalServerError("Unable to retrieve environments relations config from database", err)
@@ -76,9 +96,13 @@ func (handler *Handler) edgeStackUpdate(w http.ResponseWriter, r *http.Request)
 		return httperror.InternalServerError("Unable to retrieve edge stack related environments from database", err)
 	}
 
+	if payload.DryRun {
+		return handler.edgeStackUpdateDryRun(w, stack, &payload, relatedEndpointIds, relationConfig)
+	}
+
 	groupsIds := stack.EdgeGroups
 	if payload.EdgeGroups != nil {
-		newRelated, _, err := handler.handleChangeEdgeGroups(stack.ID, payload.EdgeGroups, relatedEndpointIds, relationConfig)
+		newRelated, _, err := handler.handleChangeEdgeGroups(stack.ID, payload.EdgeGroups, relatedEndpointIds, relationConfig, j)
 		if err != nil {
 			return httperror.InternalServerError("Unable to handle edge groups change", err)
 		}
@@ -93,6 +117,20 @@ func (handler *Handler) edgeStackUpdate(w http.ResponseWriter, r *http.Request)
 	deploymentType := stack.DeploymentType
 
 	if deploymentType != payload.DeploymentType {
+		// deployment type was changed - back up the old manifest before
+		// deleting it, so a failure later in the update can still restore it
+		oldFile := entryPoint
+		if deploymentType == portainer.EdgeStackDeploymentKubernetes {
+			oldFile = manifestPath
+		}
+
+		if oldFile != "" {
+			if previous, ferr := handler.FileService.GetFileContent(stack.ProjectPath, oldFile); ferr == nil {
+				projectPath, fileName, content := stack.ProjectPath, oldFile, previous
+				j.record(func() { handler.restoreJournaledFile(projectPath, fileName, content) })
+			}
+		}
+
 		// deployment type was changed - need to delete the old file
 		err = handler.FileService.RemoveDirectory(stack.ProjectPath)
 		if err != nil {
@@ -106,16 +144,44 @@ func (handler *Handler) edgeStackUpdate(w http.ResponseWriter, r *http.Request)
 
 	stackFolder := strconv.Itoa(int(stack.ID))
 
+	newVersion := int(stack.Version)
+	if payload.UpdateVersion {
+		newVersion++
+	}
+
+	staged := payload.UpdateVersion && stack.RolloutStrategy.Type != "" && stack.RolloutStrategy.Type != edgestackrollout.StrategyImmediate
+
+	// When staged, only the rollout's first batch is written to disk now -
+	// the rest are written by the rollout controller as later batches are
+	// promoted - instead of every related environment being updated at once.
+	writeEndpointIds := relatedEndpointIds
+
+	var rollout *edgestackrollout.Rollout
+	if staged {
+		rollout = edgestackrollout.NewRollout(stack.ID, stack.RolloutStrategy, int(stack.Version), newVersion, relatedEndpointIds)
+
+		writeEndpointIds = nil
+		if len(rollout.Batches) > 0 {
+			writeEndpointIds = rollout.Batches[0]
+		}
+	}
+
 	if deploymentType == portainer.EdgeStackDeploymentCompose {
 		if entryPoint == "" {
 			entryPoint = filesystem.ComposeFileDefaultName
 		}
 
-		_, err := handler.FileService.StoreEdgeStackFileFromBytes(stackFolder, entryPoint, []byte(payload.StackFileContent))
+		err := handler.storeEdgeStackFile(stack.ID, stackFolder, entryPoint, writeEndpointIds, []byte(payload.StackFileContent), staged, j)
 		if err != nil {
 			return httperror.InternalServerError("Unable to persist updated Compose file on disk", err)
 		}
 
+		if payload.UpdateVersion {
+			if err := handler.retainVersionedFile(stackFolder, entryPoint, newVersion, []byte(payload.StackFileContent), j); err != nil {
+				return httperror.InternalServerError("Unable to retain versioned Compose file on disk", err)
+			}
+		}
+
 		tempManifestPath, err := handler.convertAndStoreKubeManifestIfNeeded(stackFolder, stack.ProjectPath, entryPoint, relatedEndpointIds)
 		if err != nil {
 			return httperror.InternalServerError("Unable to convert and persist updated Kubernetes manifest file on disk", err)
@@ -138,15 +204,28 @@ func (handler *Handler) edgeStackUpdate(w http.ResponseWriter, r *http.Request)
 			return httperror.BadRequest("Edge stack with docker environment cannot be deployed with kubernetes config", err)
 		}
 
-		_, err = handler.FileService.StoreEdgeStackFileFromBytes(stackFolder, manifestPath, []byte(payload.StackFileContent))
+		err = handler.storeEdgeStackFile(stack.ID, stackFolder, manifestPath, writeEndpointIds, []byte(payload.StackFileContent), staged, j)
 		if err != nil {
 			return httperror.InternalServerError("Unable to persist updated Kubernetes manifest file on disk", err)
 		}
+
+		if payload.UpdateVersion {
+			if err := handler.retainVersionedFile(stackFolder, manifestPath, newVersion, []byte(payload.StackFileContent), j); err != nil {
+				return httperror.InternalServerError("Unable to retain versioned Kubernetes manifest file on disk", err)
+			}
+		}
+	}
+
+	if staged {
+		err = handler.startRollout(stack, rollout)
+		if err != nil {
+			return httperror.InternalServerError("Unable to start staged rollout", err)
+		}
 	}
 
 	err = handler.DataStore.EdgeStack().UpdateEdgeStackFunc(stack.ID, func(edgeStack *portainer.EdgeStack) {
 		edgeStack.NumDeployments = len(relatedEndpointIds)
-		if payload.UpdateVersion {
+		if payload.UpdateVersion && !staged {
 			edgeStack.Status = make(map[portainer.EndpointID]portainer.EdgeStackStatus)
 			edgeStack.Version++
 		}
@@ -166,10 +245,13 @@ func (handler *Handler) edgeStackUpdate(w http.ResponseWriter, r *http.Request)
 	return response.JSON(w, stack)
 }
 
-func (handler *Handler) handleChangeEdgeGroups(edgeStackID portainer.EdgeStackID, newEdgeGroupsIDs []portainer.EdgeGroupID, oldRelatedEnvironmentIDs []portainer.EndpointID, relationConfig *edge.EndpointRelationsConfig) ([]portainer.EndpointID, set.Set[portainer.EndpointID], error) {
+// diffEdgeGroups computes, without touching the database, how the set of
+// related environments would change if an EdgeStack's Edge groups were set
+// to newEdgeGroupsIDs.
+func diffEdgeGroups(newEdgeGroupsIDs []portainer.EdgeGroupID, oldRelatedEnvironmentIDs []portainer.EndpointID, relationConfig *edge.EndpointRelationsConfig) ([]portainer.EndpointID, set.Set[portainer.EndpointID], set.Set[portainer.EndpointID], error) {
 	newRelatedEnvironmentIDs, err := edge.EdgeStackRelatedEndpoints(newEdgeGroupsIDs, relationConfig.Endpoints, relationConfig.EndpointGroups, relationConfig.EdgeGroups)
 	if err != nil {
-		return nil, nil, errors.WithMessage(err, "Unable to retrieve edge stack related environments from database")
+		return nil, nil, nil, errors.WithMessage(err, "Unable to retrieve edge stack related environments from database")
 	}
 
 	oldRelatedSet := set.ToSet(oldRelatedEnvironmentIDs)
@@ -182,20 +264,6 @@ func (handler *Handler) handleChangeEdgeGroups(edgeStackID portainer.EdgeStackID
 		}
 	}
 
-	for endpointID := range endpointsToRemove {
-		relation, err := handler.DataStore.EndpointRelation().EndpointRelation(endpointID)
-		if err != nil {
-			return nil, nil, errors.WithMessage(err, "Unable to find environment relation in database")
-		}
-
-		delete(relation.EdgeStacks, edgeStackID)
-
-		err = handler.DataStore.EndpointRelation().UpdateEndpointRelation(endpointID, relation)
-		if err != nil {
-			return nil, nil, errors.WithMessage(err, "Unable to persist environment relation in database")
-		}
-	}
-
 	endpointsToAdd := set.Set[portainer.EndpointID]{}
 	for endpointID := range newRelatedSet {
 		if !oldRelatedSet[endpointID] {
@@ -203,18 +271,65 @@ func (handler *Handler) handleChangeEdgeGroups(edgeStackID portainer.EdgeStackID
 		}
 	}
 
-	for endpointID := range endpointsToAdd {
-		relation, err := handler.DataStore.EndpointRelation().EndpointRelation(endpointID)
-		if err != nil {
-			return nil, nil, errors.WithMessage(err, "Unable to find environment relation in database")
+	return newRelatedEnvironmentIDs, endpointsToAdd, endpointsToRemove, nil
+}
+
+// handleChangeEdgeGroups applies the EndpointRelation changes resulting
+// from moving an EdgeStack to newEdgeGroupsIDs inside a single datastore
+// transaction, so that a failure partway through leaves every relation
+// untouched rather than half-migrated. When j is non-nil, a compensating
+// action is recorded for every relation actually changed, so that a later,
+// non-transactional step (e.g. a file write) can still be undone by
+// rolling back the whole update.
+func (handler *Handler) handleChangeEdgeGroups(edgeStackID portainer.EdgeStackID, newEdgeGroupsIDs []portainer.EdgeGroupID, oldRelatedEnvironmentIDs []portainer.EndpointID, relationConfig *edge.EndpointRelationsConfig, j *updateJournal) ([]portainer.EndpointID, set.Set[portainer.EndpointID], error) {
+	newRelatedEnvironmentIDs, endpointsToAdd, endpointsToRemove, err := diffEdgeGroups(newEdgeGroupsIDs, oldRelatedEnvironmentIDs, relationConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = handler.DataStore.RunInTransaction(func(tx dataservices.DataStoreTx) error {
+		for endpointID := range endpointsToRemove {
+			relation, err := tx.EndpointRelation().EndpointRelation(endpointID)
+			if err != nil {
+				return errors.WithMessage(err, "Unable to find environment relation in database")
+			}
+
+			delete(relation.EdgeStacks, edgeStackID)
+
+			err = tx.EndpointRelation().UpdateEndpointRelation(endpointID, relation)
+			if err != nil {
+				return errors.WithMessage(err, "Unable to persist environment relation in database")
+			}
+
+			if j != nil {
+				id := endpointID
+				j.record(func() { handler.revertEndpointRelation(id, edgeStackID, true) })
+			}
 		}
 
-		relation.EdgeStacks[edgeStackID] = true
+		for endpointID := range endpointsToAdd {
+			relation, err := tx.EndpointRelation().EndpointRelation(endpointID)
+			if err != nil {
+				return errors.WithMessage(err, "Unable to find environment relation in database")
+			}
 
-		err = handler.DataStore.EndpointRelation().UpdateEndpointRelation(endpointID, relation)
-		if err != nil {
-			return nil, nil, errors.WithMessage(err, "Unable to persist environment relation in database")
+			relation.EdgeStacks[edgeStackID] = true
+
+			err = tx.EndpointRelation().UpdateEndpointRelation(endpointID, relation)
+			if err != nil {
+				return errors.WithMessage(err, "Unable to persist environment relation in database")
+			}
+
+			if j != nil {
+				id := endpointID
+				j.record(func() { handler.revertEndpointRelation(id, edgeStackID, false) })
+			}
 		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
 	}
 
 	return newRelatedEnvironmentIDs, endpointsToAdd, nil
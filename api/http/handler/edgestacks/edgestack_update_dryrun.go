@@ -0,0 +1,111 @@
+package edgestacks
+
+import (
+	"net/http"
+	"strconv"
+
+	httperror "github.com/portainer/libhttp/error"
+	"github.com/portainer/libhttp/response"
+	portainer "github.com/portainer/portainer/api"
+	"github.com/portainer/portainer/api/filesystem"
+	"github.com/portainer/portainer/api/internal/edge"
+	"github.com/rs/zerolog/log"
+)
+
+// edgeStackUpdateDiff describes the effect an EdgeStack update would have,
+// without persisting any of it.
+type edgeStackUpdateDiff struct {
+	NewVersion         int
+	AddedEndpointIDs   []portainer.EndpointID
+	RemovedEndpointIDs []portainer.EndpointID
+	Warnings           []string
+}
+
+// edgeStackUpdateDryRun runs the same validation an update would - payload
+// decode (already done by the caller), Edge group resolution, Docker vs
+// Kubernetes endpoint compatibility, and manifest conversion into a scratch
+// directory - but never calls UpdateEdgeStackFunc or mutates
+// EndpointRelation, and always removes the scratch directory before
+// returning. This mirrors the Complete/Validate split used to preview
+// changes before committing them.
+func (handler *Handler) edgeStackUpdateDryRun(w http.ResponseWriter, stack *portainer.EdgeStack, payload *updateEdgeStackPayload, relatedEndpointIds []portainer.EndpointID, relationConfig *edge.EndpointRelationsConfig) *httperror.HandlerError {
+	diff := edgeStackUpdateDiff{
+		NewVersion: int(stack.Version),
+	}
+
+	if payload.UpdateVersion {
+		diff.NewVersion++
+	}
+
+	if payload.EdgeGroups != nil {
+		newRelated, added, removed, err := diffEdgeGroups(payload.EdgeGroups, relatedEndpointIds, relationConfig)
+		if err != nil {
+			return httperror.InternalServerError("Unable to handle edge groups change", err)
+		}
+
+		relatedEndpointIds = newRelated
+
+		for endpointID := range added {
+			diff.AddedEndpointIDs = append(diff.AddedEndpointIDs, endpointID)
+		}
+
+		for endpointID := range removed {
+			diff.RemovedEndpointIDs = append(diff.RemovedEndpointIDs, endpointID)
+		}
+	}
+
+	deploymentType := stack.DeploymentType
+	if deploymentType != payload.DeploymentType {
+		deploymentType = payload.DeploymentType
+	}
+
+	if deploymentType == portainer.EdgeStackDeploymentKubernetes {
+		hasDockerEndpoint, err := hasDockerEndpoint(handler.DataStore.Endpoint(), relatedEndpointIds)
+		if err != nil {
+			return httperror.InternalServerError("Unable to check for existence of docker environment", err)
+		}
+
+		if hasDockerEndpoint {
+			diff.Warnings = append(diff.Warnings, "Edge stack with docker environment cannot be deployed with kubernetes config")
+		}
+	}
+
+	scratchFolder := strconv.Itoa(int(stack.ID)) + "-dryrun"
+	defer func() {
+		err := handler.FileService.RemoveDirectory(scratchFolder)
+		if err != nil {
+			log.Warn().Err(err).Msg("Unable to remove dry run scratch directory")
+		}
+	}()
+
+	if deploymentType == portainer.EdgeStackDeploymentCompose {
+		entryPoint := stack.EntryPoint
+		if entryPoint == "" {
+			entryPoint = filesystem.ComposeFileDefaultName
+		}
+
+		_, err := handler.FileService.StoreEdgeStackFileFromBytes(scratchFolder, entryPoint, []byte(payload.StackFileContent))
+		if err != nil {
+			return httperror.InternalServerError("Unable to validate updated Compose file", err)
+		}
+
+		_, err = handler.convertAndStoreKubeManifestIfNeeded(scratchFolder, scratchFolder, entryPoint, relatedEndpointIds)
+		if err != nil {
+			diff.Warnings = append(diff.Warnings, "Unable to convert the Compose file to a Kubernetes manifest: "+err.Error())
+		}
+	}
+
+	if deploymentType == portainer.EdgeStackDeploymentKubernetes {
+		manifestPath := stack.ManifestPath
+		if manifestPath == "" {
+			manifestPath = filesystem.ManifestFileDefaultName
+		}
+
+		_, err := handler.FileService.StoreEdgeStackFileFromBytes(scratchFolder, manifestPath, []byte(payload.StackFileContent))
+		if err != nil {
+			return httperror.InternalServerError("Unable to validate updated Kubernetes manifest file", err)
+		}
+	}
+
+	return response.JSON(w, diff)
+}
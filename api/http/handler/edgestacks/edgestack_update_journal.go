@@ -0,0 +1,72 @@
+package edgestacks
+
+import (
+	portainer "github.com/portainer/portainer/api"
+	"github.com/rs/zerolog/log"
+)
+
+// updateJournal accumulates compensating actions for the sequence of
+// otherwise non-transactional steps an EdgeStack update performs (endpoint
+// relation changes, manifest file writes). If a later step fails, rollback
+// undoes everything recorded so far, so a partial failure no longer leaves
+// the datastore and the filesystem inconsistent with each other.
+type updateJournal struct {
+	handler *Handler
+	undo    []func()
+}
+
+func newUpdateJournal(handler *Handler) *updateJournal {
+	return &updateJournal{handler: handler}
+}
+
+// record appends a compensating action to the journal.
+func (j *updateJournal) record(undo func()) {
+	j.undo = append(j.undo, undo)
+}
+
+// rollback runs every recorded compensating action, most recently recorded
+// first.
+func (j *updateJournal) rollback() {
+	for i := len(j.undo) - 1; i >= 0; i-- {
+		j.undo[i]()
+	}
+}
+
+// revertEndpointRelation restores an environment's EdgeStacks relation entry
+// to whatever it was before handleChangeEdgeGroups changed it.
+func (handler *Handler) revertEndpointRelation(endpointID portainer.EndpointID, edgeStackID portainer.EdgeStackID, wasRelated bool) {
+	relation, err := handler.DataStore.EndpointRelation().EndpointRelation(endpointID)
+	if err != nil {
+		log.Warn().Err(err).Msg("Unable to load environment relation while rolling back a failed edge stack update")
+		return
+	}
+
+	if wasRelated {
+		relation.EdgeStacks[edgeStackID] = true
+	} else {
+		delete(relation.EdgeStacks, edgeStackID)
+	}
+
+	err = handler.DataStore.EndpointRelation().UpdateEndpointRelation(endpointID, relation)
+	if err != nil {
+		log.Warn().Err(err).Msg("Unable to revert environment relation while rolling back a failed edge stack update")
+	}
+}
+
+// restoreJournaledFile writes content back to folder/fileName, logging
+// instead of failing if that cannot be done - rollback is best-effort by
+// nature.
+func (handler *Handler) restoreJournaledFile(folder, fileName string, content []byte) {
+	if _, err := handler.FileService.StoreEdgeStackFileFromBytes(folder, fileName, content); err != nil {
+		log.Warn().Err(err).Str("folder", folder).Str("fileName", fileName).Msg("Unable to restore file while rolling back a failed edge stack update")
+	}
+}
+
+// removeJournaledDirectory removes a directory created during an EdgeStack
+// update, logging instead of failing if that cannot be done - rollback is
+// best-effort by nature.
+func (handler *Handler) removeJournaledDirectory(path string) {
+	if err := handler.FileService.RemoveDirectory(path); err != nil {
+		log.Warn().Err(err).Str("path", path).Msg("Unable to remove directory while rolling back a failed edge stack update")
+	}
+}
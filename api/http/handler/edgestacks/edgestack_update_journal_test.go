@@ -0,0 +1,269 @@
+package edgestacks
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	portainer "github.com/portainer/portainer/api"
+	"github.com/portainer/portainer/api/dataservices"
+	"github.com/portainer/portainer/api/dataservices/datastore"
+	"github.com/portainer/portainer/api/dataservices/edgestackrollout"
+	"github.com/portainer/portainer/api/dataservices/edgestacktemplates"
+)
+
+// fakeFileService is an in-memory portainer.FileService used to exercise
+// journal rollback without touching disk.
+type fakeFileService struct {
+	stored map[string][]byte
+}
+
+func newFakeFileService() *fakeFileService {
+	return &fakeFileService{stored: map[string][]byte{}}
+}
+
+func fileKey(folder, fileName string) string {
+	return folder + "/" + fileName
+}
+
+func (f *fakeFileService) StoreEdgeStackFileFromBytes(edgeStackIdentifier, fileName string, data []byte) (string, error) {
+	f.stored[fileKey(edgeStackIdentifier, fileName)] = data
+	return fileKey(edgeStackIdentifier, fileName), nil
+}
+
+func (f *fakeFileService) RemoveDirectory(directoryPath string) error {
+	for k := range f.stored {
+		if k == directoryPath || strings.HasPrefix(k, directoryPath+"/") {
+			delete(f.stored, k)
+		}
+	}
+	return nil
+}
+
+func (f *fakeFileService) GetFileContent(folder, fileName string) ([]byte, error) {
+	content, ok := f.stored[fileKey(folder, fileName)]
+	if !ok {
+		return nil, dataservices.ErrObjectNotFound
+	}
+	return content, nil
+}
+
+// fakeEndpointRelationService is an in-memory portainer.EndpointRelationService.
+type fakeEndpointRelationService struct {
+	relations map[portainer.EndpointID]*portainer.EndpointRelation
+}
+
+func (s *fakeEndpointRelationService) EndpointRelation(id portainer.EndpointID) (*portainer.EndpointRelation, error) {
+	relation, ok := s.relations[id]
+	if !ok {
+		return nil, dataservices.ErrObjectNotFound
+	}
+
+	clone := *relation
+	clone.EdgeStacks = map[portainer.EdgeStackID]bool{}
+	for k, v := range relation.EdgeStacks {
+		clone.EdgeStacks[k] = v
+	}
+
+	return &clone, nil
+}
+
+func (s *fakeEndpointRelationService) UpdateEndpointRelation(id portainer.EndpointID, relation *portainer.EndpointRelation) error {
+	s.relations[id] = relation
+	return nil
+}
+
+// fakeEdgeStackService is an in-memory portainer.EdgeStackService.
+type fakeEdgeStackService struct {
+	stacks map[portainer.EdgeStackID]*portainer.EdgeStack
+}
+
+func (s *fakeEdgeStackService) EdgeStack(id portainer.EdgeStackID) (*portainer.EdgeStack, error) {
+	stack, ok := s.stacks[id]
+	if !ok {
+		return nil, dataservices.ErrObjectNotFound
+	}
+
+	clone := *stack
+	return &clone, nil
+}
+
+func (s *fakeEdgeStackService) UpdateEdgeStackFunc(id portainer.EdgeStackID, updateFunc func(edgeStack *portainer.EdgeStack)) error {
+	stack, ok := s.stacks[id]
+	if !ok {
+		return dataservices.ErrObjectNotFound
+	}
+
+	updateFunc(stack)
+	return nil
+}
+
+// fakeDataStore implements datastore.DataStore, delegating only the
+// accessors the tests in this package actually exercise. Fields left at
+// their zero value panic if reached, so a test touching an unexpected
+// accessor fails loudly instead of silently using unintended state.
+type fakeDataStore struct {
+	endpointRelations          *fakeEndpointRelationService
+	edgeStack                  *fakeEdgeStackService
+	edgeStackTemplates         *edgestacktemplates.Service
+	edgeStackTemplateOverrides *edgestacktemplates.OverridesService
+	edgeStackRollouts          *edgestackrollout.Service
+}
+
+var _ datastore.DataStore = (*fakeDataStore)(nil)
+
+func (d *fakeDataStore) EdgeStack() portainer.EdgeStackService {
+	if d.edgeStack == nil {
+		panic("not implemented")
+	}
+	return d.edgeStack
+}
+func (d *fakeDataStore) Endpoint() portainer.EndpointService { panic("not implemented") }
+func (d *fakeDataStore) EndpointRelation() portainer.EndpointRelationService {
+	return d.endpointRelations
+}
+func (d *fakeDataStore) EdgeStackTemplates() *edgestacktemplates.Service {
+	if d.edgeStackTemplates == nil {
+		panic("not implemented")
+	}
+	return d.edgeStackTemplates
+}
+func (d *fakeDataStore) EdgeStackTemplateOverrides() *edgestacktemplates.OverridesService {
+	if d.edgeStackTemplateOverrides == nil {
+		panic("not implemented")
+	}
+	return d.edgeStackTemplateOverrides
+}
+func (d *fakeDataStore) EdgeStackRollouts() *edgestackrollout.Service {
+	if d.edgeStackRollouts == nil {
+		panic("not implemented")
+	}
+	return d.edgeStackRollouts
+}
+func (d *fakeDataStore) RunInTransaction(fn func(tx dataservices.DataStoreTx) error) error {
+	panic("not implemented")
+}
+
+func TestJournalRollbackRunsInLIFOOrder(t *testing.T) {
+	j := newUpdateJournal(&Handler{})
+
+	var order []int
+	j.record(func() { order = append(order, 1) })
+	j.record(func() { order = append(order, 2) })
+	j.record(func() { order = append(order, 3) })
+
+	j.rollback()
+
+	if want := []int{3, 2, 1}; !reflect.DeepEqual(order, want) {
+		t.Errorf("got %v, want %v", order, want)
+	}
+}
+
+func TestRestoreJournaledFileRestoresPreviousContent(t *testing.T) {
+	fileService := newFakeFileService()
+	handler := &Handler{FileService: fileService}
+
+	fileService.StoreEdgeStackFileFromBytes("1", "docker-compose.yml", []byte("original"))
+
+	j := newUpdateJournal(handler)
+	previous, err := fileService.GetFileContent("1", "docker-compose.yml")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	j.record(func() { handler.restoreJournaledFile("1", "docker-compose.yml", previous) })
+
+	fileService.StoreEdgeStackFileFromBytes("1", "docker-compose.yml", []byte("updated"))
+
+	j.rollback()
+
+	got, err := fileService.GetFileContent("1", "docker-compose.yml")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(got) != "original" {
+		t.Errorf("got %q, want %q", got, "original")
+	}
+}
+
+func TestRemoveJournaledDirectoryRemovesNewlyWrittenFiles(t *testing.T) {
+	fileService := newFakeFileService()
+	handler := &Handler{FileService: fileService}
+	j := newUpdateJournal(handler)
+
+	fileService.StoreEdgeStackFileFromBytes("1/5", "docker-compose.yml", []byte("rendered"))
+	j.record(func() { handler.removeJournaledDirectory("1/5") })
+
+	j.rollback()
+
+	if _, err := fileService.GetFileContent("1/5", "docker-compose.yml"); err == nil {
+		t.Error("expected the journaled directory's file to be removed on rollback")
+	}
+}
+
+func TestPerEndpointFolderJournalRestoresRatherThanRemovesOnSecondUpdate(t *testing.T) {
+	handler, fileService := newRolloutTestHandler(t, nil)
+
+	// First staged update of an EdgeStack: the endpoint folder is new, so
+	// storeEdgeStackFile records a removal.
+	j := newUpdateJournal(handler)
+	if _, err := fileService.GetFileContent("1/5", "docker-compose.yml"); err == nil {
+		t.Fatal("expected the endpoint folder not to exist yet")
+	}
+	if err := handler.storeEdgeStackFile(1, "1", "docker-compose.yml", []portainer.EndpointID{5}, []byte("rendered v1"), true, j); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// A second update writes a new version into the same, now
+	// already-populated, endpoint folder: storeEdgeStackFile must snapshot
+	// the last-known-good content and record a restore, not a removal,
+	// so a later step failing doesn't wipe out the agent's working manifest.
+	j2 := newUpdateJournal(handler)
+	if _, err := fileService.GetFileContent("1/5", "docker-compose.yml"); err != nil {
+		t.Fatalf("expected the endpoint folder to already hold v1's render: %s", err)
+	}
+	if err := handler.storeEdgeStackFile(1, "1", "docker-compose.yml", []portainer.EndpointID{5}, []byte("rendered v2"), true, j2); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	j2.rollback()
+
+	got, err := fileService.GetFileContent("1/5", "docker-compose.yml")
+	if err != nil {
+		t.Fatalf("expected the endpoint folder to still hold a manifest after rollback, got error: %s", err)
+	}
+	if string(got) != "rendered v1" {
+		t.Errorf("got %q, want the previous render %q restored", got, "rendered v1")
+	}
+}
+
+func TestRevertEndpointRelationRestoresPreviousState(t *testing.T) {
+	relations := &fakeEndpointRelationService{relations: map[portainer.EndpointID]*portainer.EndpointRelation{
+		10: {EndpointID: 10, EdgeStacks: map[portainer.EdgeStackID]bool{1: true}},
+		20: {EndpointID: 20, EdgeStacks: map[portainer.EdgeStackID]bool{}},
+	}}
+	handler := &Handler{DataStore: &fakeDataStore{endpointRelations: relations}}
+
+	// Endpoint 20 was newly added to EdgeStack 1 by the update - undo it.
+	relations.relations[20].EdgeStacks[1] = true
+	handler.revertEndpointRelation(20, 1, false)
+
+	// Endpoint 10 had its relation to EdgeStack 1 removed by the update - undo it.
+	delete(relations.relations[10].EdgeStacks, 1)
+	handler.revertEndpointRelation(10, 1, true)
+
+	got20, err := relations.EndpointRelation(20)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got20.EdgeStacks[1] {
+		t.Error("expected endpoint 20's added relation to be reverted")
+	}
+
+	got10, err := relations.EndpointRelation(10)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !got10.EdgeStacks[1] {
+		t.Error("expected endpoint 10's removed relation to be restored")
+	}
+}
@@ -0,0 +1,125 @@
+package edgestacks
+
+import (
+	"path/filepath"
+	"strconv"
+
+	"github.com/pkg/errors"
+	portainer "github.com/portainer/portainer/api"
+	"github.com/portainer/portainer/api/dataservices"
+	"github.com/portainer/portainer/api/internal/edge"
+	"github.com/portainer/portainer/api/internal/edgestacktemplates"
+)
+
+// storeEdgeStackFile persists fileContent for an EdgeStack update.
+//
+// When staged is false (no rollout in progress), fileContent is written
+// straight to stackFolder/fileName - the canonical artifact every agent
+// without a per-environment override pulls.
+//
+// When staged is true, stackFolder/fileName is left untouched (it still
+// reflects the version every environment outside writeEndpointIds remains
+// on) and, instead, every environment in writeEndpointIds gets its new
+// content written under stackFolder/<endpointID>/fileName, so a bad
+// manifest only ever reaches the current batch.
+//
+// If the EdgeStack also has a ConfigTemplate, the same per-environment
+// folders carry the rendered manifest rather than the raw content,
+// regardless of staged, so that every agent pulls a distinct artifact
+// reflecting its effective override values.
+//
+// When j is non-nil, every write performed here is recorded so it can be
+// undone if a later step of the update fails.
+func (handler *Handler) storeEdgeStackFile(edgeStackID portainer.EdgeStackID, stackFolder, fileName string, writeEndpointIds []portainer.EndpointID, fileContent []byte, staged bool, j *updateJournal) error {
+	if !staged {
+		if j != nil {
+			if previous, ferr := handler.FileService.GetFileContent(stackFolder, fileName); ferr == nil {
+				folder, name, content := stackFolder, fileName, previous
+				j.record(func() { handler.restoreJournaledFile(folder, name, content) })
+			}
+		}
+
+		if _, err := handler.FileService.StoreEdgeStackFileFromBytes(stackFolder, fileName, fileContent); err != nil {
+			return err
+		}
+	}
+
+	template, err := handler.DataStore.EdgeStackTemplates().Template(edgeStackID)
+	hasTemplate := err == nil
+	if err != nil && err != dataservices.ErrObjectNotFound {
+		return errors.WithMessage(err, "Unable to retrieve edge stack config template from database")
+	}
+
+	if !hasTemplate && !staged {
+		// Nothing more to do: there is no per-environment override to render
+		// and, since the update wasn't staged, every environment already got
+		// the new content from the canonical write above.
+		return nil
+	}
+
+	var overrides []edgestacktemplates.OverrideSet
+	var edgeGroups []portainer.EdgeGroup
+	if hasTemplate {
+		overrides, err = handler.DataStore.EdgeStackTemplateOverrides().OverrideSetsByEdgeStackID(edgeStackID)
+		if err != nil {
+			return errors.WithMessage(err, "Unable to retrieve edge stack config template overrides from database")
+		}
+
+		relationConfig, err := edge.FetchEndpointRelationsConfig(handler.DataStore)
+		if err != nil {
+			return errors.WithMessage(err, "Unable to retrieve environments relations config from database")
+		}
+
+		edgeGroups = relationConfig.EdgeGroups
+	}
+
+	for _, endpointID := range writeEndpointIds {
+		content := fileContent
+
+		if hasTemplate {
+			edgeGroupIDs := edgeGroupsForEndpoint(endpointID, edgeGroups)
+
+			rendered, err := edgestacktemplates.Render(template, overrides, endpointID, edgeGroupIDs)
+			if err != nil {
+				return errors.WithMessagef(err, "Unable to render edge stack config template for environment %d", endpointID)
+			}
+
+			content = rendered
+		}
+
+		endpointFolder := filepath.Join(stackFolder, strconv.Itoa(int(endpointID)))
+
+		if j != nil {
+			if previous, ferr := handler.FileService.GetFileContent(endpointFolder, fileName); ferr == nil {
+				folder, name, prevContent := endpointFolder, fileName, previous
+				j.record(func() { handler.restoreJournaledFile(folder, name, prevContent) })
+			} else {
+				folder := endpointFolder
+				j.record(func() { handler.removeJournaledDirectory(folder) })
+			}
+		}
+
+		if _, err := handler.FileService.StoreEdgeStackFileFromBytes(endpointFolder, fileName, content); err != nil {
+			return errors.WithMessagef(err, "Unable to persist edge stack file for environment %d", endpointID)
+		}
+	}
+
+	return nil
+}
+
+// edgeGroupsForEndpoint returns the identifiers of every Edge group the
+// given environment belongs to.
+func edgeGroupsForEndpoint(endpointID portainer.EndpointID, edgeGroups []portainer.EdgeGroup) []portainer.EdgeGroupID {
+	var result []portainer.EdgeGroupID
+
+	for _, edgeGroup := range edgeGroups {
+		for _, id := range edgeGroup.Endpoints {
+			if id == endpointID {
+				result = append(result, edgeGroup.ID)
+				break
+			}
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,132 @@
+package edgestacks
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	portainer "github.com/portainer/portainer/api"
+	"github.com/portainer/portainer/api/internal/edgestackrollout"
+	"github.com/rs/zerolog/log"
+)
+
+// rolloutControllerInterval is how often the rollout controller checks every
+// in-flight rollout for a batch ready to promote.
+const rolloutControllerInterval = 30 * time.Second
+
+// edgestackRolloutStore adapts handler.DataStore to the edgestackrollout.Store
+// interface expected by edgestackrollout.Controller.
+type edgestackRolloutStore struct {
+	handler *Handler
+}
+
+func (s edgestackRolloutStore) Rollout(edgeStackID portainer.EdgeStackID) (*edgestackrollout.Rollout, error) {
+	return s.handler.DataStore.EdgeStackRollouts().Rollout(edgeStackID)
+}
+
+func (s edgestackRolloutStore) UpdateRollout(edgeStackID portainer.EdgeStackID, rollout *edgestackrollout.Rollout) error {
+	return s.handler.DataStore.EdgeStackRollouts().UpdateRollout(edgeStackID, rollout)
+}
+
+func (s edgestackRolloutStore) DeleteRollout(edgeStackID portainer.EdgeStackID) error {
+	return s.handler.DataStore.EdgeStackRollouts().DeleteRollout(edgeStackID)
+}
+
+// StartRolloutController starts the background goroutine that advances every
+// in-flight EdgeStack rollout, promoting batches as they become healthy. It
+// must be called once during application startup, after the Handler has been
+// constructed, and stops when ctx is canceled.
+func (handler *Handler) StartRolloutController(ctx context.Context) {
+	controller := edgestackrollout.NewController(
+		edgestackRolloutStore{handler: handler},
+		handler.activeEdgeStackIDs,
+		handler.rolloutBatchHealthy,
+		handler.applyRolloutProgress,
+	)
+
+	go controller.Start(ctx, rolloutControllerInterval)
+}
+
+// activeEdgeStackIDs lists every EdgeStack that has a rollout persisted.
+func (handler *Handler) activeEdgeStackIDs() ([]portainer.EdgeStackID, error) {
+	return handler.DataStore.EdgeStackRollouts().ActiveEdgeStackIDs()
+}
+
+// rolloutBatchHealthy reports whether an environment has last reported no
+// error specifically for version, which is the signal the rest of this
+// package uses to consider a deployment successful. A status left over from
+// before the environment was promoted to version does not count, even if it
+// carries no error.
+func (handler *Handler) rolloutBatchHealthy(edgeStackID portainer.EdgeStackID, endpointID portainer.EndpointID, version int) bool {
+	stack, err := handler.DataStore.EdgeStack().EdgeStack(edgeStackID)
+	if err != nil {
+		return false
+	}
+
+	status, ok := stack.Status[endpointID]
+
+	return ok && status.Version == version && status.Error == ""
+}
+
+// applyRolloutProgress persists the consequences of a Rollout having
+// advanced. While the rollout is still in flight, this pushes the content
+// for whichever batch Advance just promoted out to disk - mirroring the
+// initial write edgeStackUpdate performs for the first batch - so every
+// later batch actually receives the new manifest instead of only having its
+// TargetVersion bumped. Once every batch has been promoted, the EdgeStack's
+// Version is bumped to the rollout's ToVersion and its per-environment
+// Status is reset so newly-promoted environments are tracked again.
+func (handler *Handler) applyRolloutProgress(edgeStackID portainer.EdgeStackID, rollout *edgestackrollout.Rollout) {
+	if !rollout.Done() {
+		handler.writeRolloutBatch(edgeStackID, rollout)
+		return
+	}
+
+	err := handler.DataStore.EdgeStack().UpdateEdgeStackFunc(edgeStackID, func(edgeStack *portainer.EdgeStack) {
+		edgeStack.Version = rollout.ToVersion
+		edgeStack.Status = make(map[portainer.EndpointID]portainer.EdgeStackStatus)
+	})
+	if err != nil {
+		log.Warn().Err(err).Int("edgeStackID", int(edgeStackID)).Msg("Unable to persist edge stack rollout progress")
+	}
+}
+
+// writeRolloutBatch writes rollout's ToVersion content to the per-environment
+// folder of every endpoint in the batch Advance just promoted. If the
+// EdgeStack has a config template, each folder gets that template rendered
+// for its endpoint instead of the retained content. It
+// is a no-op if the current batch hasn't actually been promoted yet (Advance
+// changed the Rollout for some other reason, e.g. moving on to the next
+// batch) or if that content was never retained, which should not happen for
+// a rollout created through edgeStackUpdate.
+func (handler *Handler) writeRolloutBatch(edgeStackID portainer.EdgeStackID, rollout *edgestackrollout.Rollout) {
+	batch := rollout.Batches[rollout.CurrentBatch]
+	if !rollout.BatchPromoted(batch) {
+		return
+	}
+
+	stack, err := handler.DataStore.EdgeStack().EdgeStack(edgeStackID)
+	if err != nil {
+		log.Warn().Err(err).Int("edgeStackID", int(edgeStackID)).Msg("Unable to find edge stack while writing a promoted rollout batch")
+		return
+	}
+
+	fileName := stack.EntryPoint
+	if stack.DeploymentType == portainer.EdgeStackDeploymentKubernetes {
+		fileName = stack.ManifestPath
+	}
+
+	stackFolder := strconv.Itoa(int(stack.ID))
+	versionFolder := filepath.Join(stackFolder, "versions", strconv.Itoa(rollout.ToVersion))
+
+	content, err := handler.FileService.GetFileContent(versionFolder, fileName)
+	if err != nil {
+		log.Warn().Err(err).Int("edgeStackID", int(edgeStackID)).Int("version", rollout.ToVersion).Msg("Unable to retrieve the retained content for a promoted rollout batch")
+		return
+	}
+
+	if err := handler.storeEdgeStackFile(stack.ID, stackFolder, fileName, batch, content, true, nil); err != nil {
+		log.Warn().Err(err).Int("edgeStackID", int(edgeStackID)).Msg("Unable to write the promoted rollout batch to disk")
+	}
+}
@@ -0,0 +1,271 @@
+package edgestacks
+
+import (
+	"encoding/json"
+	"testing"
+
+	portainer "github.com/portainer/portainer/api"
+	"github.com/portainer/portainer/api/dataservices"
+	"github.com/portainer/portainer/api/dataservices/edgestackrollout"
+	"github.com/portainer/portainer/api/dataservices/edgestacktemplates"
+	internalrollout "github.com/portainer/portainer/api/internal/edgestackrollout"
+)
+
+// fakeConnection is a minimal in-memory portainer.Connection, enough to back
+// the real BaseDataService-based services (edgestacktemplates.Service,
+// edgestacktemplates.OverridesService, edgestackrollout.Service) without a
+// database.
+type fakeConnection struct {
+	buckets map[string]map[string][]byte
+	nextID  int
+}
+
+func newFakeConnection() *fakeConnection {
+	return &fakeConnection{buckets: map[string]map[string][]byte{}}
+}
+
+func (c *fakeConnection) ConvertToKey(id int) []byte {
+	return []byte{byte(id)}
+}
+
+func (c *fakeConnection) GetObject(bucketName string, key []byte, object interface{}) error {
+	bucket, ok := c.buckets[bucketName]
+	if !ok {
+		return dataservices.ErrObjectNotFound
+	}
+
+	raw, ok := bucket[string(key)]
+	if !ok {
+		return dataservices.ErrObjectNotFound
+	}
+
+	return json.Unmarshal(raw, object)
+}
+
+func (c *fakeConnection) UpdateObject(bucketName string, key []byte, object interface{}) error {
+	raw, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+
+	if c.buckets[bucketName] == nil {
+		c.buckets[bucketName] = map[string][]byte{}
+	}
+	c.buckets[bucketName][string(key)] = raw
+
+	return nil
+}
+
+func (c *fakeConnection) DeleteObject(bucketName string, key []byte) error {
+	delete(c.buckets[bucketName], string(key))
+	return nil
+}
+
+func (c *fakeConnection) CreateObject(bucketName string, fn func(id int) (int, interface{})) error {
+	c.nextID++
+	id, object := fn(c.nextID)
+	return c.UpdateObject(bucketName, c.ConvertToKey(id), object)
+}
+
+func (c *fakeConnection) GetAll(bucketName string, obj interface{}, appendFn func(o interface{}) (interface{}, error)) error {
+	for _, raw := range c.buckets[bucketName] {
+		if err := json.Unmarshal(raw, obj); err != nil {
+			return err
+		}
+
+		next, err := appendFn(obj)
+		if err != nil {
+			return err
+		}
+
+		obj = next
+	}
+
+	return nil
+}
+
+// newRolloutTestHandler builds a Handler backed by a fakeFileService and a
+// fakeDataStore whose EdgeStack() is a fakeEdgeStackService over stacks and
+// whose EdgeStackTemplates()/EdgeStackTemplateOverrides() are real services
+// over a fakeConnection, so
+// writeRolloutBatch exercises the same template-lookup path it does in
+// production.
+func newRolloutTestHandler(t *testing.T, stacks map[portainer.EdgeStackID]*portainer.EdgeStack) (*Handler, *fakeFileService) {
+	t.Helper()
+
+	connection := newFakeConnection()
+
+	templates, err := edgestacktemplates.NewService(connection)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	overrides, err := edgestacktemplates.NewOverridesService(connection)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	fileService := newFakeFileService()
+
+	handler := &Handler{
+		FileService: fileService,
+		DataStore: &fakeDataStore{
+			edgeStack:                  &fakeEdgeStackService{stacks: stacks},
+			edgeStackTemplates:         templates,
+			edgeStackTemplateOverrides: overrides,
+		},
+	}
+
+	return handler, fileService
+}
+
+func TestRolloutBatchHealthyRequiresMatchingVersion(t *testing.T) {
+	stacks := map[portainer.EdgeStackID]*portainer.EdgeStack{
+		1: {
+			ID: 1,
+			Status: map[portainer.EndpointID]portainer.EdgeStackStatus{
+				10: {EndpointID: 10, Version: 2, Error: ""},
+				20: {EndpointID: 20, Version: 1, Error: ""},
+			},
+		},
+	}
+	handler, _ := newRolloutTestHandler(t, stacks)
+
+	if !handler.rolloutBatchHealthy(1, 10, 2) {
+		t.Error("expected an endpoint that reported the target version with no error to be healthy")
+	}
+
+	if handler.rolloutBatchHealthy(1, 20, 2) {
+		t.Error("expected an endpoint that only reported an older version to be unhealthy, even with no error")
+	}
+
+	if handler.rolloutBatchHealthy(1, 30, 2) {
+		t.Error("expected an endpoint with no reported status to be unhealthy")
+	}
+}
+
+func TestWriteRolloutBatchWritesPromotedBatchContent(t *testing.T) {
+	stacks := map[portainer.EdgeStackID]*portainer.EdgeStack{
+		1: {ID: 1, EntryPoint: "docker-compose.yml"},
+	}
+	handler, fileService := newRolloutTestHandler(t, stacks)
+
+	fileService.StoreEdgeStackFileFromBytes("1/versions/2", "docker-compose.yml", []byte("v2 content"))
+
+	rollout := &internalrollout.Rollout{
+		EdgeStackID:  1,
+		Strategy:     internalrollout.Strategy{Type: internalrollout.StrategyBatched, BatchSize: 1},
+		FromVersion:  1,
+		ToVersion:    2,
+		State:        internalrollout.StateActive,
+		Batches:      [][]portainer.EndpointID{{10}, {20}},
+		CurrentBatch: 1,
+		TargetVersions: map[portainer.EndpointID]int{
+			10: 2,
+			20: 2,
+		},
+	}
+
+	handler.applyRolloutProgress(1, rollout)
+
+	got, err := fileService.GetFileContent("1/20", "docker-compose.yml")
+	if err != nil {
+		t.Fatalf("expected the promoted batch's endpoint folder to have been written: %s", err)
+	}
+	if string(got) != "v2 content" {
+		t.Errorf("got %q, want %q", got, "v2 content")
+	}
+
+	if _, err := fileService.GetFileContent("1/10", "docker-compose.yml"); err == nil {
+		t.Error("expected the already-promoted first batch not to be rewritten")
+	}
+}
+
+func TestWriteRolloutBatchIsNoOpUntilBatchPromoted(t *testing.T) {
+	stacks := map[portainer.EdgeStackID]*portainer.EdgeStack{
+		1: {ID: 1, EntryPoint: "docker-compose.yml"},
+	}
+	handler, fileService := newRolloutTestHandler(t, stacks)
+
+	fileService.StoreEdgeStackFileFromBytes("1/versions/2", "docker-compose.yml", []byte("v2 content"))
+
+	rollout := &internalrollout.Rollout{
+		EdgeStackID:  1,
+		Strategy:     internalrollout.Strategy{Type: internalrollout.StrategyBatched, BatchSize: 1},
+		FromVersion:  1,
+		ToVersion:    2,
+		State:        internalrollout.StateActive,
+		Batches:      [][]portainer.EndpointID{{10}, {20}},
+		CurrentBatch: 1,
+		TargetVersions: map[portainer.EndpointID]int{
+			10: 2,
+			20: 1,
+		},
+	}
+
+	handler.applyRolloutProgress(1, rollout)
+
+	if _, err := fileService.GetFileContent("1/20", "docker-compose.yml"); err == nil {
+		t.Error("expected no content to be written before the batch is promoted")
+	}
+}
+
+func TestApplyRolloutProgressBumpsVersionAndResetsStatusOnceDone(t *testing.T) {
+	stacks := map[portainer.EdgeStackID]*portainer.EdgeStack{
+		1: {
+			ID:      1,
+			Version: 1,
+			Status: map[portainer.EndpointID]portainer.EdgeStackStatus{
+				10: {EndpointID: 10, Version: 2, Error: ""},
+			},
+		},
+	}
+	handler, _ := newRolloutTestHandler(t, stacks)
+
+	rollout := &internalrollout.Rollout{
+		EdgeStackID:    1,
+		FromVersion:    1,
+		ToVersion:      2,
+		State:          internalrollout.StateCompleted,
+		Batches:        [][]portainer.EndpointID{{10}},
+		CurrentBatch:   1,
+		TargetVersions: map[portainer.EndpointID]int{10: 2},
+	}
+
+	handler.applyRolloutProgress(1, rollout)
+
+	stack, err := handler.DataStore.EdgeStack().EdgeStack(1)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if stack.Version != 2 {
+		t.Errorf("expected EdgeStack.Version to be bumped to ToVersion, got %d", stack.Version)
+	}
+	if len(stack.Status) != 0 {
+		t.Errorf("expected Status to be reset, got %v", stack.Status)
+	}
+}
+
+func TestEdgestackRolloutStoreDeleteRollout(t *testing.T) {
+	connection := newFakeConnection()
+	rollouts, err := edgestackrollout.NewService(connection)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	handler := &Handler{DataStore: &fakeDataStore{edgeStackRollouts: rollouts}}
+	store := edgestackRolloutStore{handler: handler}
+
+	rollout := internalrollout.NewRollout(1, internalrollout.Strategy{Type: internalrollout.StrategyImmediate}, 1, 2, []portainer.EndpointID{10})
+	if err := store.UpdateRollout(1, rollout); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := store.DeleteRollout(1); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := store.Rollout(1); err != dataservices.ErrObjectNotFound {
+		t.Errorf("expected the rollout to have been deleted, got err %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package edgestacks
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	httperror "github.com/portainer/libhttp/error"
+	portainer "github.com/portainer/portainer/api"
+	"github.com/portainer/portainer/api/dataservices/datastore"
+)
+
+// Handler is the HTTP handler used to handle edge stack operations.
+type Handler struct {
+	*mux.Router
+	DataStore   datastore.DataStore
+	FileService portainer.FileService
+}
+
+// NewHandler creates a Handler and registers every edge stack route - the
+// update endpoint, the config template, override and preview endpoints, and
+// the rollout inspect/pause/resume/abort/rollback endpoints - onto router.
+func NewHandler(router *mux.Router, dataStore datastore.DataStore, fileService portainer.FileService) *Handler {
+	h := &Handler{
+		Router:      router,
+		DataStore:   dataStore,
+		FileService: fileService,
+	}
+
+	h.Handle("/edge_stacks/{id}", httperror.LoggerHandler(h.edgeStackUpdate)).Methods(http.MethodPut)
+
+	h.Handle("/edge_stacks/{id}/template", httperror.LoggerHandler(h.edgeStackTemplateInspect)).Methods(http.MethodGet)
+	h.Handle("/edge_stacks/{id}/template", httperror.LoggerHandler(h.edgeStackTemplateUpdate)).Methods(http.MethodPut)
+	h.Handle("/edge_stacks/{id}/template/preview", httperror.LoggerHandler(h.edgeStackTemplatePreview)).Methods(http.MethodGet)
+	h.Handle("/edge_stacks/{id}/template/overrides", httperror.LoggerHandler(h.edgeStackTemplateOverrideList)).Methods(http.MethodGet)
+	h.Handle("/edge_stacks/{id}/template/overrides", httperror.LoggerHandler(h.edgeStackTemplateOverrideCreate)).Methods(http.MethodPost)
+	h.Handle("/edge_stacks/{id}/template/overrides/{overrideId}", httperror.LoggerHandler(h.edgeStackTemplateOverrideUpdate)).Methods(http.MethodPut)
+	h.Handle("/edge_stacks/{id}/template/overrides/{overrideId}", httperror.LoggerHandler(h.edgeStackTemplateOverrideDelete)).Methods(http.MethodDelete)
+
+	h.Handle("/edge_stacks/{id}/rollout", httperror.LoggerHandler(h.edgeStackRolloutInspect)).Methods(http.MethodGet)
+	h.Handle("/edge_stacks/{id}/rollout/pause", httperror.LoggerHandler(h.edgeStackRolloutPause)).Methods(http.MethodPost)
+	h.Handle("/edge_stacks/{id}/rollout/resume", httperror.LoggerHandler(h.edgeStackRolloutResume)).Methods(http.MethodPost)
+	h.Handle("/edge_stacks/{id}/rollout/abort", httperror.LoggerHandler(h.edgeStackRolloutAbort)).Methods(http.MethodPost)
+	h.Handle("/edge_stacks/{id}/rollout/rollback", httperror.LoggerHandler(h.edgeStackRolloutRollback)).Methods(http.MethodPost)
+
+	return h
+}
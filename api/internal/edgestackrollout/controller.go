@@ -0,0 +1,104 @@
+package edgestackrollout
+
+import (
+	portainer "github.com/portainer/portainer/api"
+)
+
+// IsBatchHealthy reports whether at least minHealthyRatio of the
+// environments in batch satisfy isHealthy. A minHealthyRatio of 0 or less is
+// treated as 1 (every environment must be healthy), matching
+// EdgeStackRolloutStrategy.MinHealthyRatio's documented default.
+func IsBatchHealthy(batch []portainer.EndpointID, minHealthyRatio float32, isHealthy func(portainer.EndpointID) bool) bool {
+	if len(batch) == 0 {
+		return true
+	}
+
+	if minHealthyRatio <= 0 {
+		minHealthyRatio = 1
+	}
+
+	healthy := 0
+	for _, id := range batch {
+		if isHealthy(id) {
+			healthy++
+		}
+	}
+
+	return float32(healthy)/float32(len(batch)) >= minHealthyRatio
+}
+
+// Advance moves an active Rollout forward by at most one step: if the
+// current batch has not yet been promoted to ToVersion, it is promoted now;
+// otherwise, once isHealthy confirms at least Strategy.MinHealthyRatio of
+// the environments in that batch (every one of them by default) are healthy
+// on the new version, the rollout moves on to the next batch. It
+// returns true if the Rollout was modified and should be persisted.
+func (r *Rollout) Advance(isHealthy func(portainer.EndpointID) bool) bool {
+	if r.State != StateActive || r.Done() {
+		return false
+	}
+
+	batch := r.Batches[r.CurrentBatch]
+
+	if !r.BatchPromoted(batch) {
+		for _, id := range batch {
+			r.TargetVersions[id] = r.ToVersion
+		}
+
+		return true
+	}
+
+	if !IsBatchHealthy(batch, r.Strategy.MinHealthyRatio, isHealthy) {
+		return false
+	}
+
+	r.CurrentBatch++
+	if r.Done() {
+		r.State = StateCompleted
+	}
+
+	return true
+}
+
+// BatchPromoted reports whether every environment in batch has already had
+// its TargetVersion set to ToVersion, i.e. whether the manifest for batch
+// still needs to be pushed out now that Advance has decided to promote it.
+func (r *Rollout) BatchPromoted(batch []portainer.EndpointID) bool {
+	for _, id := range batch {
+		if r.TargetVersions[id] != r.ToVersion {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Pause stops further batch promotion until Resume is called.
+func (r *Rollout) Pause() {
+	if r.State == StateActive {
+		r.State = StatePaused
+	}
+}
+
+// Resume re-activates a paused rollout.
+func (r *Rollout) Resume() {
+	if r.State == StatePaused {
+		r.State = StateActive
+	}
+}
+
+// Abort stops the rollout. Environments keep whatever version they were
+// last promoted to.
+func (r *Rollout) Abort() {
+	r.State = StateAborted
+}
+
+// Rollback reverts every environment's target version back to FromVersion
+// and marks the rollout as aborted.
+func (r *Rollout) Rollback() {
+	for id := range r.TargetVersions {
+		r.TargetVersions[id] = r.FromVersion
+	}
+
+	r.State = StateAborted
+}
@@ -0,0 +1,105 @@
+package edgestackrollout
+
+import (
+	"testing"
+
+	portainer "github.com/portainer/portainer/api"
+)
+
+func TestIsBatchHealthy(t *testing.T) {
+	healthy := map[int]bool{1: true, 2: true, 3: false}
+	isHealthy := func(id portainer.EndpointID) bool { return healthy[int(id)] }
+
+	if !IsBatchHealthy(endpointIDs(1, 2), 1, isHealthy) {
+		t.Error("expected a batch of only healthy environments to be healthy")
+	}
+
+	if IsBatchHealthy(endpointIDs(1, 2, 3), 1, isHealthy) {
+		t.Error("expected a batch containing an unhealthy environment to be unhealthy at the default ratio")
+	}
+}
+
+func TestIsBatchHealthyMinHealthyRatio(t *testing.T) {
+	healthy := map[int]bool{1: true, 2: true, 3: false, 4: false}
+	isHealthy := func(id portainer.EndpointID) bool { return healthy[int(id)] }
+
+	if !IsBatchHealthy(endpointIDs(1, 2, 3, 4), 0.5, isHealthy) {
+		t.Error("expected a half-healthy batch to satisfy a MinHealthyRatio of 0.5")
+	}
+
+	if IsBatchHealthy(endpointIDs(1, 2, 3, 4), 0.75, isHealthy) {
+		t.Error("expected a half-healthy batch not to satisfy a MinHealthyRatio of 0.75")
+	}
+
+	if IsBatchHealthy(endpointIDs(1, 2, 3, 4), 0, isHealthy) {
+		t.Error("expected a MinHealthyRatio of 0 to default to requiring every environment healthy")
+	}
+}
+
+func TestAdvancePromotesThenWaitsForHealth(t *testing.T) {
+	rollout := NewRollout(1, Strategy{Type: StrategyBatched, BatchSize: 1}, 1, 2, endpointIDs(10, 20))
+
+	healthy := map[int]bool{}
+	isHealthy := func(id portainer.EndpointID) bool { return healthy[int(id)] }
+
+	// First Advance promotes the current batch's target version but does not
+	// move on, since the promoted environment hasn't reported healthy yet.
+	if changed := rollout.Advance(isHealthy); !changed {
+		t.Fatal("expected Advance to promote the first batch")
+	}
+	if rollout.TargetVersions[10] != 2 {
+		t.Errorf("expected batch 0 to be promoted to ToVersion, got %d", rollout.TargetVersions[10])
+	}
+	if rollout.CurrentBatch != 0 {
+		t.Errorf("expected CurrentBatch to stay at 0 until the batch reports healthy, got %d", rollout.CurrentBatch)
+	}
+
+	// Not yet healthy: Advance should be a no-op.
+	if changed := rollout.Advance(isHealthy); changed {
+		t.Error("expected Advance to be a no-op while the current batch is unhealthy")
+	}
+
+	// Once healthy, Advance moves on to the next batch.
+	healthy[10] = true
+	if changed := rollout.Advance(isHealthy); !changed {
+		t.Fatal("expected Advance to move on once the batch is healthy")
+	}
+	if rollout.CurrentBatch != 1 {
+		t.Errorf("expected CurrentBatch to advance to 1, got %d", rollout.CurrentBatch)
+	}
+
+	// Promote and complete the final batch.
+	rollout.Advance(isHealthy)
+	healthy[20] = true
+	rollout.Advance(isHealthy)
+
+	if !rollout.Done() {
+		t.Error("expected the rollout to be done once every batch is promoted and healthy")
+	}
+	if rollout.State != StateCompleted {
+		t.Errorf("expected State to be StateCompleted, got %s", rollout.State)
+	}
+}
+
+func TestAdvanceIsNoOpWhenNotActiveOrDone(t *testing.T) {
+	rollout := NewRollout(1, Strategy{Type: StrategyImmediate}, 1, 2, endpointIDs(10))
+	rollout.Pause()
+
+	alwaysHealthy := func(portainer.EndpointID) bool { return true }
+
+	if changed := rollout.Advance(alwaysHealthy); changed {
+		t.Error("expected Advance to be a no-op on a paused rollout")
+	}
+
+	rollout.Resume()
+	rollout.Advance(alwaysHealthy)
+	rollout.Advance(alwaysHealthy)
+
+	if !rollout.Done() {
+		t.Fatal("expected the single-batch rollout to be done")
+	}
+
+	if changed := rollout.Advance(alwaysHealthy); changed {
+		t.Error("expected Advance to be a no-op once the rollout is done")
+	}
+}
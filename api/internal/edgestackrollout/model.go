@@ -0,0 +1,130 @@
+// Package edgestackrollout implements staged and canary rollout of EdgeStack
+// versions across the environments (endpoints) a stack is related to.
+//
+// Instead of bumping every related environment to a new Version in one
+// shot, a Rollout splits the related endpoints into ordered batches and
+// promotes one batch at a time, only moving on once at least the strategy's
+// MinHealthyRatio of the endpoints in the current batch (all of them by
+// default) have reported back a healthy status for the new version.
+package edgestackrollout
+
+import (
+	portainer "github.com/portainer/portainer/api"
+)
+
+// StrategyType identifies how a new EdgeStack version is rolled out to its
+// related environments. It is an alias of portainer.EdgeStackRolloutStrategyType
+// so that EdgeStack.RolloutStrategy and Rollout.Strategy share one
+// definition.
+type StrategyType = portainer.EdgeStackRolloutStrategyType
+
+const (
+	// StrategyImmediate promotes every related environment to the new
+	// version at once - this is the pre-existing behavior.
+	StrategyImmediate = portainer.EdgeStackRolloutStrategyImmediate
+	// StrategyBatched promotes related environments in fixed-size batches.
+	StrategyBatched = portainer.EdgeStackRolloutStrategyBatched
+	// StrategyCanary promotes a single environment first, then the
+	// remaining environments in fixed-size batches once the canary is
+	// healthy.
+	StrategyCanary = portainer.EdgeStackRolloutStrategyCanary
+)
+
+// Strategy configures how a Rollout splits related environments into
+// batches. It is an alias of portainer.EdgeStackRolloutStrategy so that
+// EdgeStack.RolloutStrategy can be passed directly to NewRollout.
+type Strategy = portainer.EdgeStackRolloutStrategy
+
+// State is the lifecycle state of a Rollout.
+type State string
+
+const (
+	StateActive    State = "active"
+	StatePaused    State = "paused"
+	StateAborted   State = "aborted"
+	StateCompleted State = "completed"
+)
+
+// Rollout tracks the progress of a staged version rollout for an EdgeStack.
+// It is persisted so that the rollout controller can resume progressing it
+// across restarts.
+type Rollout struct {
+	EdgeStackID portainer.EdgeStackID `json:"EdgeStackID"`
+	Strategy    Strategy              `json:"Strategy"`
+
+	FromVersion int `json:"FromVersion"`
+	ToVersion   int `json:"ToVersion"`
+
+	State State `json:"State"`
+
+	// Batches is the ordered list of batches of environments to promote to
+	// ToVersion.
+	Batches [][]portainer.EndpointID `json:"Batches"`
+	// CurrentBatch is the index, within Batches, of the batch currently
+	// being promoted or awaited on. It is len(Batches) once the rollout has
+	// completed.
+	CurrentBatch int `json:"CurrentBatch"`
+	// TargetVersions records, for every related environment, which version
+	// it has been promoted to so far. Environments not yet promoted remain
+	// at FromVersion.
+	TargetVersions map[portainer.EndpointID]int `json:"TargetVersions"`
+}
+
+// PlanBatches splits relatedEndpointIDs into ordered batches according to
+// strategy.
+func PlanBatches(strategy Strategy, relatedEndpointIDs []portainer.EndpointID) [][]portainer.EndpointID {
+	if strategy.Type == StrategyImmediate || len(relatedEndpointIDs) == 0 {
+		return [][]portainer.EndpointID{relatedEndpointIDs}
+	}
+
+	batchSize := strategy.BatchSize
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	var batches [][]portainer.EndpointID
+
+	remaining := relatedEndpointIDs
+	if strategy.Type == StrategyCanary {
+		batches = append(batches, remaining[:1])
+		remaining = remaining[1:]
+	}
+
+	for len(remaining) > 0 {
+		end := batchSize
+		if end > len(remaining) {
+			end = len(remaining)
+		}
+
+		batches = append(batches, remaining[:end])
+		remaining = remaining[end:]
+	}
+
+	return batches
+}
+
+// NewRollout creates a Rollout for promoting relatedEndpointIDs from
+// fromVersion to toVersion according to strategy. Every environment starts
+// out pinned to fromVersion.
+func NewRollout(edgeStackID portainer.EdgeStackID, strategy Strategy, fromVersion, toVersion int, relatedEndpointIDs []portainer.EndpointID) *Rollout {
+	targetVersions := make(map[portainer.EndpointID]int, len(relatedEndpointIDs))
+	for _, id := range relatedEndpointIDs {
+		targetVersions[id] = fromVersion
+	}
+
+	return &Rollout{
+		EdgeStackID:    edgeStackID,
+		Strategy:       strategy,
+		FromVersion:    fromVersion,
+		ToVersion:      toVersion,
+		State:          StateActive,
+		Batches:        PlanBatches(strategy, relatedEndpointIDs),
+		CurrentBatch:   0,
+		TargetVersions: targetVersions,
+	}
+}
+
+// Done reports whether every batch has been promoted.
+func (r *Rollout) Done() bool {
+	return r.CurrentBatch >= len(r.Batches)
+}
@@ -0,0 +1,99 @@
+package edgestackrollout
+
+import (
+	"reflect"
+	"testing"
+
+	portainer "github.com/portainer/portainer/api"
+)
+
+func endpointIDs(ids ...int) []portainer.EndpointID {
+	result := make([]portainer.EndpointID, len(ids))
+	for i, id := range ids {
+		result[i] = portainer.EndpointID(id)
+	}
+
+	return result
+}
+
+func TestPlanBatchesImmediate(t *testing.T) {
+	batches := PlanBatches(Strategy{Type: StrategyImmediate}, endpointIDs(1, 2, 3))
+
+	want := [][]portainer.EndpointID{endpointIDs(1, 2, 3)}
+	if !reflect.DeepEqual(batches, want) {
+		t.Errorf("got %v, want %v", batches, want)
+	}
+}
+
+func TestPlanBatchesBatched(t *testing.T) {
+	batches := PlanBatches(Strategy{Type: StrategyBatched, BatchSize: 2}, endpointIDs(1, 2, 3, 4, 5))
+
+	want := [][]portainer.EndpointID{endpointIDs(1, 2), endpointIDs(3, 4), endpointIDs(5)}
+	if !reflect.DeepEqual(batches, want) {
+		t.Errorf("got %v, want %v", batches, want)
+	}
+}
+
+func TestPlanBatchesBatchedDefaultsBatchSizeToOne(t *testing.T) {
+	batches := PlanBatches(Strategy{Type: StrategyBatched}, endpointIDs(1, 2))
+
+	want := [][]portainer.EndpointID{endpointIDs(1), endpointIDs(2)}
+	if !reflect.DeepEqual(batches, want) {
+		t.Errorf("got %v, want %v", batches, want)
+	}
+}
+
+func TestPlanBatchesCanarySingleEnvironmentFirst(t *testing.T) {
+	batches := PlanBatches(Strategy{Type: StrategyCanary, BatchSize: 2}, endpointIDs(1, 2, 3, 4, 5))
+
+	want := [][]portainer.EndpointID{endpointIDs(1), endpointIDs(2, 3), endpointIDs(4, 5)}
+	if !reflect.DeepEqual(batches, want) {
+		t.Errorf("got %v, want %v", batches, want)
+	}
+}
+
+func TestNewRolloutPinsEveryEnvironmentToFromVersion(t *testing.T) {
+	rollout := NewRollout(1, Strategy{Type: StrategyBatched, BatchSize: 1}, 1, 2, endpointIDs(10, 20))
+
+	for _, id := range endpointIDs(10, 20) {
+		if rollout.TargetVersions[id] != 1 {
+			t.Errorf("expected environment %d to start at FromVersion, got %d", id, rollout.TargetVersions[id])
+		}
+	}
+
+	if rollout.State != StateActive {
+		t.Errorf("expected a new rollout to be active, got %s", rollout.State)
+	}
+
+	if rollout.Done() {
+		t.Error("expected a freshly created rollout not to be done")
+	}
+}
+
+func TestPauseResumeAbortRollback(t *testing.T) {
+	rollout := NewRollout(1, Strategy{Type: StrategyBatched, BatchSize: 1}, 1, 2, endpointIDs(10))
+
+	rollout.Pause()
+	if rollout.State != StatePaused {
+		t.Fatalf("expected Pause to set StatePaused, got %s", rollout.State)
+	}
+
+	rollout.Resume()
+	if rollout.State != StateActive {
+		t.Fatalf("expected Resume to set StateActive, got %s", rollout.State)
+	}
+
+	rollout.Abort()
+	if rollout.State != StateAborted {
+		t.Fatalf("expected Abort to set StateAborted, got %s", rollout.State)
+	}
+
+	rollout.TargetVersions[10] = 2
+	rollout.Rollback()
+	if rollout.State != StateAborted {
+		t.Fatalf("expected Rollback to set StateAborted, got %s", rollout.State)
+	}
+	if rollout.TargetVersions[10] != 1 {
+		t.Errorf("expected Rollback to revert every environment to FromVersion, got %d", rollout.TargetVersions[10])
+	}
+}
@@ -0,0 +1,92 @@
+package edgestackrollout
+
+import (
+	"context"
+	"time"
+
+	portainer "github.com/portainer/portainer/api"
+)
+
+// Store is the subset of the rollout datastore the Controller needs.
+type Store interface {
+	Rollout(portainer.EdgeStackID) (*Rollout, error)
+	UpdateRollout(portainer.EdgeStackID, *Rollout) error
+	DeleteRollout(portainer.EdgeStackID) error
+}
+
+// Controller periodically advances every active Rollout.
+type Controller struct {
+	store        Store
+	edgeStackIDs func() ([]portainer.EdgeStackID, error)
+	isHealthy    func(portainer.EdgeStackID, portainer.EndpointID, int) bool
+	apply        func(portainer.EdgeStackID, *Rollout)
+}
+
+// NewController creates a Controller.
+//
+//   - edgeStackIDs lists every EdgeStack that may have an in-flight rollout.
+//   - isHealthy reports whether an environment has reported back healthy
+//     specifically for the given version (e.g. by checking that its latest
+//     EdgeStackStatus has that Version and an empty Error) - a stale report
+//     from before the environment was promoted must not count.
+//   - apply is called whenever Advance changes a Rollout, so the caller can
+//     push the content for a newly-promoted batch out to disk and bump the
+//     EdgeStack's Version once the rollout completes.
+func NewController(
+	store Store,
+	edgeStackIDs func() ([]portainer.EdgeStackID, error),
+	isHealthy func(portainer.EdgeStackID, portainer.EndpointID, int) bool,
+	apply func(portainer.EdgeStackID, *Rollout),
+) *Controller {
+	return &Controller{store: store, edgeStackIDs: edgeStackIDs, isHealthy: isHealthy, apply: apply}
+}
+
+// Start runs the controller loop until ctx is canceled, advancing every
+// active rollout once per interval.
+func (c *Controller) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.tick()
+		}
+	}
+}
+
+func (c *Controller) tick() {
+	ids, err := c.edgeStackIDs()
+	if err != nil {
+		return
+	}
+
+	for _, id := range ids {
+		rollout, err := c.store.Rollout(id)
+		if err != nil {
+			continue
+		}
+
+		changed := rollout.Advance(func(endpointID portainer.EndpointID) bool {
+			return c.isHealthy(id, endpointID, rollout.ToVersion)
+		})
+
+		if !changed {
+			continue
+		}
+
+		if rollout.State == StateCompleted || rollout.State == StateAborted {
+			if err := c.store.DeleteRollout(id); err != nil {
+				continue
+			}
+		} else if err := c.store.UpdateRollout(id, rollout); err != nil {
+			continue
+		}
+
+		if c.apply != nil {
+			c.apply(id, rollout)
+		}
+	}
+}
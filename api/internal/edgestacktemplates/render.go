@@ -0,0 +1,64 @@
+package edgestacktemplates
+
+import (
+	"bytes"
+	"text/template"
+
+	"github.com/pkg/errors"
+	portainer "github.com/portainer/portainer/api"
+	"github.com/portainer/portainer/api/dataservices/edgestacktemplates"
+)
+
+// EffectiveValues merges a Template's DefaultValues with the OverrideSets
+// that apply to the given environment. EndpointID-scoped overrides take
+// precedence over EdgeGroupID-scoped ones, which in turn take precedence
+// over the Template's DefaultValues.
+func EffectiveValues(tpl *edgestacktemplates.Template, overrides []edgestacktemplates.OverrideSet, endpointID portainer.EndpointID, edgeGroupIDs []portainer.EdgeGroupID) map[string]interface{} {
+	values := map[string]interface{}{}
+	for k, v := range tpl.DefaultValues {
+		values[k] = v
+	}
+
+	edgeGroupSet := map[portainer.EdgeGroupID]bool{}
+	for _, id := range edgeGroupIDs {
+		edgeGroupSet[id] = true
+	}
+
+	for _, o := range overrides {
+		if o.Scope == edgestacktemplates.OverrideScopeEdgeGroup && edgeGroupSet[o.EdgeGroupID] {
+			for k, v := range o.Values {
+				values[k] = v
+			}
+		}
+	}
+
+	for _, o := range overrides {
+		if o.Scope == edgestacktemplates.OverrideScopeEndpoint && o.EndpointID == endpointID {
+			for k, v := range o.Values {
+				values[k] = v
+			}
+		}
+	}
+
+	return values
+}
+
+// Render executes a Template's Content against the effective values for the
+// given environment and returns the rendered manifest. The merged values are
+// exposed to the template under `.Values`, mirroring Helm's convention.
+func Render(tpl *edgestacktemplates.Template, overrides []edgestacktemplates.OverrideSet, endpointID portainer.EndpointID, edgeGroupIDs []portainer.EdgeGroupID) ([]byte, error) {
+	values := EffectiveValues(tpl, overrides, endpointID, edgeGroupIDs)
+
+	t, err := template.New("edgestack").Option("missingkey=zero").Parse(tpl.Content)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Unable to parse edge stack config template")
+	}
+
+	var buf bytes.Buffer
+	err = t.Execute(&buf, map[string]interface{}{"Values": values})
+	if err != nil {
+		return nil, errors.WithMessage(err, "Unable to render edge stack config template")
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,101 @@
+package edgestacktemplates
+
+import (
+	"testing"
+
+	portainer "github.com/portainer/portainer/api"
+	"github.com/portainer/portainer/api/dataservices/edgestacktemplates"
+)
+
+func TestEffectiveValuesPrecedence(t *testing.T) {
+	tpl := &edgestacktemplates.Template{
+		DefaultValues: map[string]interface{}{"replicas": "1", "tag": "default"},
+	}
+
+	overrides := []edgestacktemplates.OverrideSet{
+		{
+			Scope:       edgestacktemplates.OverrideScopeEdgeGroup,
+			EdgeGroupID: 1,
+			Values:      map[string]interface{}{"tag": "edgegroup", "region": "eu"},
+		},
+		{
+			Scope:      edgestacktemplates.OverrideScopeEndpoint,
+			EndpointID: 5,
+			Values:     map[string]interface{}{"tag": "endpoint"},
+		},
+	}
+
+	values := EffectiveValues(tpl, overrides, 5, []portainer.EdgeGroupID{1})
+
+	if values["replicas"] != "1" {
+		t.Errorf("expected DefaultValues to be kept when not overridden, got %v", values["replicas"])
+	}
+	if values["region"] != "eu" {
+		t.Errorf("expected EdgeGroup override to apply, got %v", values["region"])
+	}
+	if values["tag"] != "endpoint" {
+		t.Errorf("expected endpoint-scoped override to win over edgegroup-scoped and default, got %v", values["tag"])
+	}
+}
+
+func TestEffectiveValuesIgnoresNonMatchingOverrides(t *testing.T) {
+	tpl := &edgestacktemplates.Template{
+		DefaultValues: map[string]interface{}{"tag": "default"},
+	}
+
+	overrides := []edgestacktemplates.OverrideSet{
+		{Scope: edgestacktemplates.OverrideScopeEdgeGroup, EdgeGroupID: 2, Values: map[string]interface{}{"tag": "other-group"}},
+		{Scope: edgestacktemplates.OverrideScopeEndpoint, EndpointID: 99, Values: map[string]interface{}{"tag": "other-endpoint"}},
+	}
+
+	values := EffectiveValues(tpl, overrides, 5, []portainer.EdgeGroupID{1})
+
+	if values["tag"] != "default" {
+		t.Errorf("expected override sets for a different group/environment to be ignored, got %v", values["tag"])
+	}
+}
+
+func TestRenderExposesEffectiveValues(t *testing.T) {
+	tpl := &edgestacktemplates.Template{
+		Content:       "replicas: {{ .Values.replicas }}",
+		DefaultValues: map[string]interface{}{"replicas": "1"},
+	}
+
+	overrides := []edgestacktemplates.OverrideSet{
+		{Scope: edgestacktemplates.OverrideScopeEndpoint, EndpointID: 5, Values: map[string]interface{}{"replicas": "3"}},
+	}
+
+	rendered, err := Render(tpl, overrides, 5, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if got, want := string(rendered), "replicas: 3"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRenderMissingValueRendersZero(t *testing.T) {
+	tpl := &edgestacktemplates.Template{
+		Content:       "tag: {{ .Values.tag }}",
+		DefaultValues: map[string]interface{}{},
+	}
+
+	rendered, err := Render(tpl, nil, 1, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if got, want := string(rendered), "tag: "; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRenderInvalidTemplateReturnsError(t *testing.T) {
+	tpl := &edgestacktemplates.Template{Content: "{{ .Values.tag"}
+
+	_, err := Render(tpl, nil, 1, nil)
+	if err == nil {
+		t.Fatal("expected an error for an unparsable template")
+	}
+}
@@ -0,0 +1,153 @@
+// Package portainer declares the subset of the core domain model and
+// storage-facing interfaces referenced by the edge stack config template,
+// override and rollout features. The full domain model is considerably
+// larger and lives alongside the rest of the application; only the pieces
+// those features actually touch are reproduced here.
+package portainer
+
+// EdgeStackID represents the identifier of an EdgeStack.
+type EdgeStackID int
+
+// EndpointID represents the identifier of an environment (endpoint).
+type EndpointID int
+
+// EdgeGroupID represents the identifier of an Edge group.
+type EdgeGroupID int
+
+// EdgeGroup represents a named group of environments used to target Edge
+// stacks.
+type EdgeGroup struct {
+	ID        EdgeGroupID  `json:"Id"`
+	Endpoints []EndpointID `json:"Endpoints"`
+}
+
+// EdgeStackDeploymentType represents the technology used to deploy an Edge
+// stack.
+type EdgeStackDeploymentType int
+
+const (
+	// EdgeStackDeploymentCompose deploys the stack as a Docker Compose file.
+	EdgeStackDeploymentCompose EdgeStackDeploymentType = iota
+	// EdgeStackDeploymentKubernetes deploys the stack as a Kubernetes manifest.
+	EdgeStackDeploymentKubernetes
+)
+
+// EdgeStackStatus represents the latest status reported by an environment
+// for an EdgeStack.
+type EdgeStackStatus struct {
+	EndpointID EndpointID `json:"EndpointID"`
+	// Version is the EdgeStack version the environment last reported
+	// applying. A rollout only considers an environment healthy for a
+	// batch once it has reported back on the batch's ToVersion - an older
+	// report left over from before the environment was promoted does not
+	// count.
+	Version int `json:"Version"`
+	// Error holds the last error reported by the environment, if any. An
+	// empty Error means the environment is considered healthy.
+	Error string `json:"Error,omitempty"`
+}
+
+// EdgeStack represents a set of Kubernetes manifests or a Compose file
+// pushed to and managed on a set of environments through the Edge agent.
+type EdgeStack struct {
+	ID             EdgeStackID                    `json:"Id"`
+	EdgeGroups     []EdgeGroupID                  `json:"EdgeGroups"`
+	Version        int                            `json:"Version"`
+	NumDeployments int                            `json:"NumDeployments"`
+	Status         map[EndpointID]EdgeStackStatus `json:"Status"`
+
+	ProjectPath    string                  `json:"ProjectPath"`
+	EntryPoint     string                  `json:"EntryPoint"`
+	ManifestPath   string                  `json:"ManifestPath"`
+	DeploymentType EdgeStackDeploymentType `json:"DeploymentType"`
+
+	UseManifestNamespaces bool `json:"UseManifestNamespaces"`
+
+	RolloutStrategy EdgeStackRolloutStrategy `json:"RolloutStrategy"`
+}
+
+// EdgeStackRolloutStrategyType identifies how a new EdgeStack version is
+// rolled out to its related environments.
+type EdgeStackRolloutStrategyType string
+
+const (
+	// EdgeStackRolloutStrategyImmediate promotes every related environment
+	// to the new version at once - this is the default behavior.
+	EdgeStackRolloutStrategyImmediate EdgeStackRolloutStrategyType = "immediate"
+	// EdgeStackRolloutStrategyBatched promotes related environments in
+	// fixed-size batches.
+	EdgeStackRolloutStrategyBatched EdgeStackRolloutStrategyType = "batched"
+	// EdgeStackRolloutStrategyCanary promotes a single environment first,
+	// then the remaining environments in fixed-size batches once the canary
+	// is healthy.
+	EdgeStackRolloutStrategyCanary EdgeStackRolloutStrategyType = "canary"
+)
+
+// EdgeStackRolloutStrategy configures how an EdgeStack update splits its
+// related environments into batches instead of updating every environment
+// at once.
+type EdgeStackRolloutStrategy struct {
+	Type EdgeStackRolloutStrategyType `json:"Type"`
+	// BatchSize is the number of environments promoted at a time. Ignored
+	// for EdgeStackRolloutStrategyImmediate. For
+	// EdgeStackRolloutStrategyCanary, BatchSize applies to every batch after
+	// the first (single-environment) canary batch.
+	BatchSize int `json:"BatchSize"`
+	// MinHealthyRatio is the fraction (0-1) of environments in a batch that
+	// must report a healthy status for the new version before the next
+	// batch is promoted. Defaults to 1 (every environment must be healthy).
+	MinHealthyRatio float32 `json:"MinHealthyRatio"`
+}
+
+// Endpoint represents an environment registered with the platform.
+type Endpoint struct {
+	ID EndpointID `json:"Id"`
+}
+
+// EndpointRelation tracks which Edge stacks are related to an environment.
+type EndpointRelation struct {
+	EndpointID EndpointID           `json:"EndpointID"`
+	EdgeStacks map[EdgeStackID]bool `json:"EdgeStacks"`
+}
+
+// EdgeStackService represents a service for managing EdgeStacks.
+type EdgeStackService interface {
+	EdgeStack(ID EdgeStackID) (*EdgeStack, error)
+	UpdateEdgeStackFunc(ID EdgeStackID, updateFunc func(edgeStack *EdgeStack)) error
+}
+
+// EndpointService represents a service for managing environments.
+type EndpointService interface {
+	Endpoint(ID EndpointID) (*Endpoint, error)
+}
+
+// EndpointRelationService represents a service for managing environment
+// relations.
+type EndpointRelationService interface {
+	EndpointRelation(EndpointID EndpointID) (*EndpointRelation, error)
+	UpdateEndpointRelation(EndpointID EndpointID, relation *EndpointRelation) error
+}
+
+// Connection represents a connection to the underlying key/value store used
+// to persist every bucket-backed service.
+type Connection interface {
+	GetObject(bucketName string, key []byte, object interface{}) error
+	UpdateObject(bucketName string, key []byte, object interface{}) error
+	DeleteObject(bucketName string, key []byte) error
+	CreateObject(bucketName string, fn func(id int) (int, interface{})) error
+	ConvertToKey(id int) []byte
+	// GetAll calls append once per object stored in bucketName, passing a
+	// freshly-decoded copy of obj each time; whatever append returns is
+	// reused as the decode target for the next object.
+	GetAll(bucketName string, obj interface{}, append func(o interface{}) (interface{}, error)) error
+}
+
+// FileService represents a service for managing files on disk.
+type FileService interface {
+	StoreEdgeStackFileFromBytes(edgeStackIdentifier, fileName string, data []byte) (string, error)
+	RemoveDirectory(directoryPath string) error
+	// GetFileContent returns the content of fileName under folder. Callers
+	// use it to snapshot a file before overwriting or removing it, so that
+	// the previous content can be restored if a later step fails.
+	GetFileContent(folder, fileName string) ([]byte, error)
+}